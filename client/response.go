@@ -0,0 +1,63 @@
+// Package client models the results the analyzer streams over its websocket,
+// so that Go clients can decode them into typed values.
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// Status is the kind of a Response.
+type Status int
+
+const (
+	// StatusSuccess is a result of a check.
+	StatusSuccess Status = iota
+	// StatusFailure reports that a check or the analysis failed.
+	StatusFailure
+	// StatusComplete is the last response of a completed analysis.
+	StatusComplete
+	// StatusProgress reports what the analysis is doing.
+	StatusProgress
+	// StatusKeepalive keeps an idle connection open and carries no result.
+	StatusKeepalive
+	// StatusWarning is a result of a check which points out a problem.
+	StatusWarning
+)
+
+var statusNames = []string{"success", "failure", "complete", "progress", "keepalive", "warning"}
+
+func (s Status) String() string {
+	if s < 0 || int(s) >= len(statusNames) {
+		return fmt.Sprintf("Status(%d)", int(s))
+	}
+	return statusNames[s]
+}
+
+// Response is a message streamed to the client.
+type Response struct {
+	// ID identifies the analysis a response belongs to. It is empty for
+	// responses outside of an analysis.
+	ID string
+	// Label is the untranslated label of the result, such as "h1 count",
+	// whatever the locale of the analysis. It is empty for messages without one.
+	Label string
+	// Result is a "label : value" message in the locale of the analysis, with
+	// the value html escaped.
+	Result string
+	Status Status
+}
+
+// Decode decodes a message received from the analyzer.
+func Decode(data []byte) (Response, error) {
+	var response Response
+	if err := json.Unmarshal(data, &response); err != nil {
+		return Response{}, errors.Wrap(err, "Failed to decode response")
+	}
+	if response.Status < StatusSuccess || response.Status > StatusWarning {
+		return Response{}, errors.Errorf("unknown response status: %d", int(response.Status))
+	}
+	return response, nil
+}
@@ -0,0 +1,143 @@
+package client
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDecodeRoundTrip(t *testing.T) {
+	for status := StatusSuccess; status <= StatusWarning; status++ {
+		sent := Response{ID: "3f2a9c01b7d4", Label: "title", Result: "title : a &amp; b", Status: status}
+		data, err := json.Marshal(sent)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		received, err := Decode(data)
+		if err != nil {
+			t.Fatalf("Decode(%s): %v", data, err)
+		}
+		if received != sent {
+			t.Errorf("Decode(%s) = %+v, want %+v", data, received, sent)
+		}
+	}
+}
+
+func TestDecodeRejectsInvalidMessages(t *testing.T) {
+	for _, data := range []string{`not json`, `{"Status": 9}`, `{"Status": -1}`} {
+		if _, err := Decode([]byte(data)); err == nil {
+			t.Errorf("Decode(%s) succeeded, want an error", data)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		response Response
+		want     Result
+	}{
+		{
+			Response{Label: "h1 count", Result: "h1 count : 2"},
+			Count{Label: "h1 count", Count: 2},
+		},
+		{
+			Response{Label: "html comments", Result: "html comments : 4 (conditional: 1)"},
+			Count{Label: "html comments", Count: 4, Detail: "(conditional: 1)"},
+		},
+		{
+			Response{Label: "third party domains", Result: "third party domains : 2 (cdn.example.com(3), fonts.example.net(1))"},
+			Counts{Label: "third party domains", Total: 2, Counts: map[string]int{"cdn.example.com": 3, "fonts.example.net": 1}},
+		},
+		{
+			Response{Label: "image formats", Result: "image formats : png(3), webp(1)"},
+			Counts{Label: "image formats", Total: 4, Counts: map[string]int{"png": 3, "webp": 1}},
+		},
+		{
+			Response{Label: "duplicate ids", Result: "duplicate ids : none"},
+			Counts{Label: "duplicate ids", Counts: map[string]int{}},
+		},
+		{
+			Response{Label: "feeds", Result: "feeds : http://example.com/rss.xml, http://example.com/atom.xml"},
+			List{Label: "feeds", Items: []string{"http://example.com/rss.xml", "http://example.com/atom.xml"}},
+		},
+		{
+			Response{Label: "tracking pixels", Result: "tracking pixels : 2 (facebook.com, google-analytics.com)"},
+			List{Label: "tracking pixels", Items: []string{"facebook.com", "google-analytics.com"}},
+		},
+		{
+			Response{Label: "redirects", Result: "redirects : 2 (http://example.com/a -&gt; https://example.com/a)"},
+			List{Label: "redirects", Items: []string{"http://example.com/a", "https://example.com/a"}},
+		},
+		{
+			Response{Label: "sitemap", Result: "sitemap : not found"},
+			List{Label: "sitemap"},
+		},
+		{
+			Response{Label: "skip link", Result: "skip link : true"},
+			Flag{Label: "skip link", Value: true},
+		},
+		{
+			Response{Label: "time to first byte", Result: "time to first byte : 120ms"},
+			TimeToFirstByte{Duration: 120 * time.Millisecond},
+		},
+		{
+			Response{Label: "dns", Result: "dns : 1ms, connect : 2ms, tls : 3ms"},
+			ConnectionTiming{DNS: time.Millisecond, Connect: 2 * time.Millisecond, TLS: 3 * time.Millisecond},
+		},
+		{
+			Response{Label: "score deductions", Result: "score deductions : has title, has lang attribute"},
+			ScoreDeductions{Criteria: []string{"has title", "has lang attribute"}},
+		},
+		{
+			Response{Label: "analyzing completed", Result: "analyzing completed : total processing time 1.5s, score 85/100", Status: StatusComplete},
+			Completion{ProcessingTime: 1500 * time.Millisecond, Score: 85},
+		},
+		{
+			// labels are translated, the untranslated Label identifies the result.
+			Response{Label: "h1 count", Result: "Anzahl h1 : 1"},
+			Count{Label: "h1 count", Count: 1},
+		},
+		{
+			Response{Label: "analyzing completed", Result: "Analyse abgeschlossen : total processing time 2s, score 100/100", Status: StatusComplete},
+			Completion{ProcessingTime: 2 * time.Second, Score: 100},
+		},
+		{
+			// without a Label, the label of the result is used.
+			Response{Result: "external link count : 7"},
+			Count{Label: "external link count", Count: 7},
+		},
+		{
+			Response{Label: "title", Result: "title : Fish &amp; Chips"},
+			Text{Label: "title", Value: "Fish & Chips"},
+		},
+		{
+			Response{Label: "h2 count", Result: "h2 count : many"},
+			Text{Label: "h2 count", Value: "many"},
+		},
+	}
+
+	for _, test := range tests {
+		data, err := json.Marshal(test.response)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, err := Decode(data)
+		if err != nil {
+			t.Fatalf("Decode(%s): %v", data, err)
+		}
+		if got := response.Parse(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Parse(%q) = %#v, want %#v", test.response.Result, got, test.want)
+		}
+	}
+}
+
+func TestStatusString(t *testing.T) {
+	if got := StatusWarning.String(); got != "warning" {
+		t.Errorf("StatusWarning.String() = %q, want warning", got)
+	}
+	if got := Status(42).String(); got != "Status(42)" {
+		t.Errorf("Status(42).String() = %q, want Status(42)", got)
+	}
+}
@@ -0,0 +1,246 @@
+package client
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Result is a typed result of a check, one of Count, Counts, List, Flag,
+// TimeToFirstByte, ConnectionTiming, ScoreDeductions, Completion or Text.
+type Result interface {
+	result()
+}
+
+// Count is a result counting something, such as "h1 count : 2". Detail holds
+// what follows the count, such as "(conditional: 1)" for html comments.
+type Count struct {
+	Label  string
+	Count  int
+	Detail string
+}
+
+// Counts is a result counting occurrences by key, such as
+// "image formats : png(3), webp(1)". Total is the count given before
+// the keys, such as the 2 of "third party domains : 2 (...)", or else the
+// sum of the counts. Counts may list only the most frequent keys.
+type Counts struct {
+	Label  string
+	Total  int
+	Counts map[string]int
+}
+
+// List is a result listing values, such as the urls of "feeds". It is empty
+// when nothing was found.
+type List struct {
+	Label string
+	Items []string
+}
+
+// Flag is a result which is true or false, such as "skip link : true".
+type Flag struct {
+	Label string
+	Value bool
+}
+
+// TimeToFirstByte is the time to the first byte of the preflight request.
+type TimeToFirstByte struct {
+	Duration time.Duration
+}
+
+// ConnectionTiming is the time the connection of the preflight request took to set up.
+type ConnectionTiming struct {
+	DNS     time.Duration
+	Connect time.Duration
+	TLS     time.Duration
+}
+
+// ScoreDeductions lists the score criteria a page failed.
+type ScoreDeductions struct {
+	Criteria []string
+}
+
+// Completion is the last result of a completed analysis.
+type Completion struct {
+	ProcessingTime time.Duration
+	Score          int
+}
+
+// Text is a result without a more specific type, or one which couldn't be parsed as its type.
+type Text struct {
+	Label string
+	Value string
+}
+
+func (Count) result()            {}
+func (Counts) result()           {}
+func (List) result()             {}
+func (Flag) result()             {}
+func (TimeToFirstByte) result()  {}
+func (ConnectionTiming) result() {}
+func (ScoreDeductions) result()  {}
+func (Completion) result()       {}
+func (Text) result()             {}
+
+func labels(names ...string) map[string]bool {
+	set := map[string]bool{}
+	for _, name := range names {
+		set[name] = true
+	}
+	return set
+}
+
+var (
+	countLabels = labels(
+		"h1 count", "h2 count", "h3 count", "h4 count", "h5 count", "h6 count",
+		"internal link count", "external link count", "absolute internal links",
+		"accesskeys", "autoplay media", "content word count", "email addresses",
+		"forms without action", "html comments", "html size", "images without accessible name",
+		"inline !important declarations", "inline event handlers", "low-quality alt text",
+		"max DOM depth", "noscript blocks", "pages crawled", "positive tabindex elements",
+		"status code", "unsafe target=_blank links", "viewport-unit inline styles", "word count",
+	)
+	countsLabels = labels(
+		"accesskey conflicts", "data attributes", "duplicate ids", "empty elements", "image formats",
+		"possible untagged foreign-language content", "semantic elements", "third party domains",
+	)
+	listLabels = map[string]string{
+		"app metadata":          ", ",
+		"broken internal links": ", ",
+		"feeds":                 ", ",
+		"http-equiv headers":    ", ",
+		"redirects":             " -> ",
+		"sitemap":               ", ",
+		"tracking pixels":       ", ",
+		"web fonts":             ", ",
+	}
+	flagLabels = labels(
+		"connection reused", "contain login form", "do not track checked", "privacy policy link",
+		"pwa candidate", "service worker registration", "skip link", "terms link",
+	)
+	// emptyValues are the values of results which found nothing.
+	emptyValues = labels("0", "none", "not found")
+
+	leadingCount    = regexp.MustCompile(`^(\d+)(?: (.*))?$`)
+	parenthesized   = regexp.MustCompile(`^\((.*)\)$`)
+	keyCount        = regexp.MustCompile(`^(.+)\((\d+)\)$`)
+	completionValue = regexp.MustCompile(`total processing time (\S+), score (\d+)/100`)
+	timingValue     = regexp.MustCompile(`^(\S+), connect : (\S+), tls : (\S+)$`)
+)
+
+// Parse returns the typed result of r. Results are told apart by their untranslated
+// label, so parsing doesn't depend on the locale of the analysis.
+func (r Response) Parse() Result {
+	var value string
+	parts := strings.SplitN(r.Result, " : ", 2)
+	if len(parts) == 2 {
+		value = parts[1]
+	}
+	label := r.Label
+	if label == "" {
+		label = parts[0]
+	}
+	text := Text{Label: label, Value: html.UnescapeString(value)}
+
+	switch {
+	case countLabels[label]:
+		match := leadingCount.FindStringSubmatch(text.Value)
+		if match == nil {
+			return text
+		}
+		count, _ := strconv.Atoi(match[1])
+		return Count{Label: label, Count: count, Detail: match[2]}
+
+	case countsLabels[label]:
+		return parseCounts(label, text)
+
+	case listLabels[label] != "":
+		list := List{Label: label}
+		items := text.Value
+		if match := leadingCount.FindStringSubmatch(items); match != nil {
+			// lists preceded by their length, such as "2 (a, b)".
+			items = strings.TrimSpace(parenthesized.ReplaceAllString(match[2], "$1"))
+		}
+		if items == "" || emptyValues[items] {
+			return list
+		}
+		list.Items = strings.Split(items, listLabels[label])
+		return list
+
+	case flagLabels[label]:
+		value, err := strconv.ParseBool(text.Value)
+		if err != nil {
+			return text
+		}
+		return Flag{Label: label, Value: value}
+
+	case label == "time to first byte":
+		duration, err := time.ParseDuration(text.Value)
+		if err != nil {
+			return text
+		}
+		return TimeToFirstByte{Duration: duration}
+
+	case label == "dns":
+		// the message is "dns : 1ms, connect : 2ms, tls : 3ms".
+		match := timingValue.FindStringSubmatch(text.Value)
+		if match == nil {
+			return text
+		}
+		var timing ConnectionTiming
+		for i, field := range []*time.Duration{&timing.DNS, &timing.Connect, &timing.TLS} {
+			duration, err := time.ParseDuration(match[i+1])
+			if err != nil {
+				return text
+			}
+			*field = duration
+		}
+		return timing
+
+	case label == "score deductions":
+		return ScoreDeductions{Criteria: strings.Split(text.Value, ", ")}
+
+	case label == "analyzing completed":
+		match := completionValue.FindStringSubmatch(text.Value)
+		if match == nil {
+			return text
+		}
+		duration, err := time.ParseDuration(match[1])
+		if err != nil {
+			return text
+		}
+		score, _ := strconv.Atoi(match[2])
+		return Completion{ProcessingTime: duration, Score: score}
+	}
+	return text
+}
+
+// parseCounts parses "key(n), ..." pairs, optionally preceded by a total
+// such as "3 (a(2), b(1))".
+func parseCounts(label string, text Text) Result {
+	counts := Counts{Label: label, Counts: map[string]int{}}
+	pairs := text.Value
+	if match := leadingCount.FindStringSubmatch(pairs); match != nil {
+		counts.Total, _ = strconv.Atoi(match[1])
+		pairs = strings.TrimSpace(parenthesized.ReplaceAllString(match[2], "$1"))
+	}
+	if pairs == "" || emptyValues[pairs] {
+		return counts
+	}
+
+	for _, pair := range strings.Split(pairs, ", ") {
+		match := keyCount.FindStringSubmatch(pair)
+		if match == nil {
+			return text
+		}
+		counts.Counts[match[1]], _ = strconv.Atoi(match[2])
+	}
+	if counts.Total == 0 {
+		for _, count := range counts.Counts {
+			counts.Total += count
+		}
+	}
+	return counts
+}
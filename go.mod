@@ -7,6 +7,7 @@ require (
 	github.com/pkg/errors v0.9.1
 	github.com/sclevine/agouti v3.0.0+incompatible
 	golang.org/x/net v0.0.0-20211209124913-491a49abca63
+	golang.org/x/text v0.3.6
 )
 
 require (
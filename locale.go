@@ -0,0 +1,74 @@
+package main
+
+import "strings"
+
+const defaultLocale = "en"
+
+// catalogs maps a locale to translations of message labels, keyed by the English label.
+// English needs no catalog, it is the language messages are written in.
+var catalogs = map[string]map[string]string{
+	"de": {
+		"title":                     "Titel",
+		"html version":              "HTML-Version",
+		"h1 count":                  "Anzahl h1",
+		"h2 count":                  "Anzahl h2",
+		"h3 count":                  "Anzahl h3",
+		"h4 count":                  "Anzahl h4",
+		"h5 count":                  "Anzahl h5",
+		"h6 count":                  "Anzahl h6",
+		"internal link count":       "Anzahl interner Links",
+		"external link count":       "Anzahl externer Links",
+		"contain login form":        "enthält Anmeldeformular",
+		"third party domains":       "Drittanbieter-Domains",
+		"web fonts":                 "Webschriften",
+		"low-quality alt text":      "Alternativtexte geringer Qualität",
+		"html comments":             "HTML-Kommentare",
+		"sitemap":                   "Sitemap",
+		"resource hints":            "Ressourcenhinweise",
+		"email addresses":           "E-Mail-Adressen",
+		"max DOM depth":             "maximale DOM-Tiefe",
+		"duplicate ids":             "doppelte IDs",
+		"tables":                    "Tabellen",
+		"https upgrade":             "HTTPS-Umleitung",
+		"viewport":                  "Viewport",
+		"viewport prevents zooming": "Viewport verhindert Zoomen",
+		"inline event handlers":     "Inline-Eventhandler",
+		"csp blocked resources":     "durch CSP blockierte Ressourcen",
+		"score deductions":          "Punktabzüge",
+		"analyzing completed":       "Analyse abgeschlossen",
+	},
+}
+
+// resolveLocale returns the requested locale if it is supported, or else the first
+// supported language of an Accept-Language header, falling back to English.
+func resolveLocale(requested, acceptLanguage string) string {
+	candidates := []string{requested}
+	for _, tag := range strings.Split(acceptLanguage, ",") {
+		candidates = append(candidates, strings.SplitN(tag, ";", 2)[0])
+	}
+
+	for _, candidate := range candidates {
+		language := strings.ToLower(strings.TrimSpace(strings.SplitN(candidate, "-", 2)[0]))
+		if _, ok := catalogs[language]; ok || language == defaultLocale {
+			return language
+		}
+	}
+	return defaultLocale
+}
+
+// localize translates the label of a "label : value" message into locale.
+// Messages without a translation are returned unchanged.
+func localize(locale, message string) string {
+	catalog, ok := catalogs[locale]
+	if !ok {
+		return message
+	}
+
+	parts := strings.SplitN(message, " : ", 2)
+	translation, ok := catalog[parts[0]]
+	if !ok {
+		return message
+	}
+	parts[0] = translation
+	return strings.Join(parts, " : ")
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mjmyaseer/webPageAnalyzer/client"
+	"golang.org/x/net/websocket"
+)
+
+func TestResolveLocale(t *testing.T) {
+	tests := []struct {
+		requested, acceptLanguage string
+		want                      string
+	}{
+		{"", "", "en"},
+		{"de", "", "de"},
+		{"DE-at", "", "de"},
+		{"", "de-DE,de;q=0.9,en;q=0.8", "de"},
+		{"", "fr-FR, de;q=0.5", "de"},
+		{"en", "de-DE", "en"},
+		{"fr", "fr-FR", "en"},
+	}
+
+	for _, test := range tests {
+		if got := resolveLocale(test.requested, test.acceptLanguage); got != test.want {
+			t.Errorf("resolveLocale(%q, %q) = %q, want %q", test.requested, test.acceptLanguage, got, test.want)
+		}
+	}
+}
+
+func TestLocalize(t *testing.T) {
+	tests := []struct {
+		locale, message, want string
+	}{
+		{"en", "h1 count : 2", "h1 count : 2"},
+		{"de", "h1 count : 2", "Anzahl h1 : 2"},
+		{"de", "title : a : b", "Titel : a : b"},
+		{"de", "untranslated : 2", "untranslated : 2"},
+		{"de", "fetching...", "fetching..."},
+		{"fr", "title : x", "title : x"},
+	}
+
+	for _, test := range tests {
+		if got := localize(test.locale, test.message); got != test.want {
+			t.Errorf("localize(%q, %q) = %q, want %q", test.locale, test.message, got, test.want)
+		}
+	}
+}
+
+func TestAnalyzeLocalized(t *testing.T) {
+	document := `{"type": "html", "locale": "de", "html": "<html><head><title>Seite</title></head><body></body></html>"}`
+	responses := analyzeMessage(t, document)
+	for _, response := range responses {
+		if response.Label == "title" && response.Result != "Titel : Seite" {
+			t.Errorf("title result = %q, want it translated", response.Result)
+		}
+	}
+	if got := valueOf(t, responses, "title"); got != "Seite" {
+		t.Errorf("title = %q", got)
+	}
+
+	server := httptest.NewServer(websocket.Handler(websocketHandler))
+	defer server.Close()
+	config, err := websocket.NewConfig("ws"+strings.TrimPrefix(server.URL, "http")+"/", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Header.Set("Accept-Language", "de-DE,de;q=0.9")
+	ws, err := websocket.DialConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	if err = websocket.Message.Send(ws, strings.Replace(document, `"locale": "de", `, "", 1)); err != nil {
+		t.Fatal(err)
+	}
+	responses = readUntil(t, ws, func(response client.Response) bool { return response.Status == client.StatusComplete })
+	if !hasResult(responses, "Titel : Seite") {
+		t.Errorf("responses = %v, want the title translated from Accept-Language", responses)
+	}
+	if last := responses[len(responses)-1]; !strings.HasPrefix(last.Result, "Analyse abgeschlossen : ") || last.Label != "analyzing completed" {
+		t.Errorf("completion = %v, want it translated", last)
+	}
+}
@@ -1,53 +1,156 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
 	"crypto/tls"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"github.com/PuerkitoBio/goquery"
+	"github.com/mjmyaseer/webPageAnalyzer/client"
 	"github.com/pkg/errors"
 	"github.com/sclevine/agouti"
 	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+	"golang.org/x/net/publicsuffix"
 	"golang.org/x/net/websocket"
+	"golang.org/x/text/transform"
 	"html/template"
+	"io"
 	"log"
+	"math"
+	"mime"
+	"net"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
 	"os"
+	"path"
+	"path/filepath"
 	"regexp"
+	"runtime"
+	"runtime/debug"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 )
 
 var driver *agouti.WebDriver
 
-func init() {
-	driver = agouti.ChromeDriver(
-		agouti.ChromeOptions("args", []string{
+// Build information, set at build time with -ldflags "-X main.version=... -X main.commit=...".
+var (
+	version = "dev"
+	commit  = "none"
+)
+
+// Setup starts the Chrome driver used to render web pages.
+func Setup() error {
+	chromeDriver := newChromeDriver()
+	if err := chromeDriver.Start(); err != nil {
+		return errors.Wrap(err, "Failed to start driver")
+	}
+	driver = chromeDriver
+	return nil
+}
+
+// newChromeDriver returns a ChromeDriver running the chromedriver of ANALYZER_CHROMEDRIVER_PATH,
+// or the one on PATH, with the Chrome options of chromeOptions.
+func newChromeDriver() *agouti.WebDriver {
+	var options []agouti.Option
+	for name, value := range chromeOptions() {
+		options = append(options, agouti.ChromeOptions(name, value))
+	}
+
+	driverPath := getEnv("ANALYZER_CHROMEDRIVER_PATH", "")
+	if driverPath == "" {
+		return agouti.ChromeDriver(options...)
+	}
+	return agouti.NewWebDriver("http://{{.Address}}", []string{driverPath, "--port={{.Port}}"}, options...)
+}
+
+// chromeOptions returns the options Chrome is started with, including the Chrome
+// binary of ANALYZER_CHROME_BINARY, if set.
+func chromeOptions() map[string]interface{} {
+	options := map[string]interface{}{
+		"args": []string{
 			"--headless",
 			"--window-size=1680,1050",
 			"--no-sandbox",
 			"--disable-gpu",
-		}),
-	)
-	err := driver.Start()
-	if err != nil {
-		log.Printf("Failed to start driver. please restart server: %v", err)
-		os.Exit(1)
+		},
+	}
+	if binary := getEnv("ANALYZER_CHROME_BINARY", ""); binary != "" {
+		options["binary"] = binary
+	}
+	return options
+}
+
+// windowSize is the size of the Chrome window a page is rendered in.
+type windowSize struct {
+	width  int
+	height int
+}
+
+// deviceProfiles maps device names to the window size they are emulated with.
+var deviceProfiles = map[string]windowSize{
+	"mobile":  {width: 375, height: 812},
+	"tablet":  {width: 768, height: 1024},
+	"desktop": {width: 1680, height: 1050},
+}
+
+// parseDevice returns the window size for a device profile name or an explicit
+// size such as "1280x720". An empty device is a desktop.
+func parseDevice(device string) (windowSize, error) {
+	device = strings.ToLower(strings.TrimSpace(device))
+	if device == "" {
+		return deviceProfiles["desktop"], nil
+	}
+	if size, ok := deviceProfiles[device]; ok {
+		return size, nil
+	}
+
+	dimensions := strings.SplitN(device, "x", 2)
+	if len(dimensions) == 2 {
+		width, widthErr := strconv.Atoi(dimensions[0])
+		height, heightErr := strconv.Atoi(dimensions[1])
+		if widthErr == nil && heightErr == nil && width > 0 && height > 0 {
+			return windowSize{width: width, height: height}, nil
+		}
 	}
+	return windowSize{}, errors.Errorf("unsupported device: %s", html.EscapeString(device))
 }
 
-func getHTML(url string) (string, error) {
+func getHTML(url string, size windowSize, progress func(message string)) (string, error) {
+	if driver == nil {
+		return "", errors.New("Failed to open page: driver not started")
+	}
 	page, err := driver.NewPage(agouti.Browser("chrome"))
 	if err != nil {
 		return "", errors.Wrap(err, "Failed to open page")
 	}
+	defer page.Destroy()
+
+	if err = page.Size(size.width, size.height); err != nil {
+		return "", errors.Wrap(err, "Failed to resize window")
+	}
 
+	progress("rendering...")
 	err = page.Navigate(url)
 	if err != nil {
 		return "", errors.Wrap(err, "Failed to Navigate")
 	}
+	// Chrome follows redirects on its own, which may lead to a denied domain.
+	if current, err := page.URL(); err == nil {
+		if err = checkDomain(current); err != nil {
+			return "", err
+		}
+	}
 
 	content, err := page.HTML()
 	if err != nil {
@@ -57,8 +160,14 @@ func getHTML(url string) (string, error) {
 	return content, nil
 }
 
-func getDocument(html string) (*goquery.Document, error) {
-	reader := strings.NewReader(html)
+// getDocument parses html into a document. HTML which isn't valid UTF-8 is transcoded
+// using the charset from contentType or, failing that, from the document itself.
+func getDocument(html string, contentType string) (*goquery.Document, error) {
+	var reader io.Reader = strings.NewReader(html)
+	if !utf8.ValidString(html) {
+		encoding, _, _ := charset.DetermineEncoding([]byte(html), contentType)
+		reader = transform.NewReader(reader, encoding.NewDecoder())
+	}
 
 	doc, err := goquery.NewDocumentFromReader(reader)
 	if err != nil {
@@ -76,6 +185,56 @@ func getEnv(key, defaultValue string) string {
 	return env
 }
 
+func getEnvInt(key string, defaultValue int) int {
+	env := os.Getenv(key)
+	if env == "" {
+		return defaultValue
+	}
+	value, err := strconv.Atoi(env)
+	if err != nil {
+		log.Printf("Invalid value for %s, using default %d: %v", key, defaultValue, err)
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	env := os.Getenv(key)
+	if env == "" {
+		return defaultValue
+	}
+	value, err := strconv.ParseBool(env)
+	if err != nil {
+		log.Printf("Invalid value for %s, using default %t: %v", key, defaultValue, err)
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvList returns the comma separated values of key, lower cased, without empty ones.
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.ToLower(strings.TrimSpace(value)); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	env := os.Getenv(key)
+	if env == "" {
+		return defaultValue
+	}
+	value, err := time.ParseDuration(env)
+	if err != nil {
+		log.Printf("Invalid value for %s, using default %s: %v", key, defaultValue, err)
+		return defaultValue
+	}
+	return value
+}
+
 func webSocketHost() string {
 	return getEnv("ANALYZER_WEBSOCKET_HOST", "localhost")
 }
@@ -84,229 +243,3626 @@ func webSocketPort() string {
 	return getEnv("ANALYZER_WEBSOCKET_PORT", "8080")
 }
 
+//go:embed view/index.html.tpl
+var views embed.FS
+
+// indexTemplate is parsed once at startup by main.
+var indexTemplate *template.Template
+
+// parseIndex parses the index template from ANALYZER_VIEW_DIR if set,
+// or else the copy embedded in the binary.
+func parseIndex() (*template.Template, error) {
+	if dir := getEnv("ANALYZER_VIEW_DIR", ""); dir != "" {
+		return template.ParseFiles(filepath.Join(dir, "index.html.tpl"))
+	}
+	return template.ParseFS(views, "view/index.html.tpl")
+}
+
 func index(w http.ResponseWriter, _ *http.Request) {
 	params := map[string]string{
 		"WebSocketHost": webSocketHost(),
 		"WebSocketPort": webSocketPort(),
 	}
 
-	t := template.Must(template.ParseFiles("view/index.html.tpl"))
-	if err := t.ExecuteTemplate(w, "index.html.tpl", params); err != nil {
+	var page bytes.Buffer
+	if err := indexTemplate.ExecuteTemplate(&page, "index.html.tpl", params); err != nil {
 		log.Printf("Failed to parse view: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if _, err := page.WriteTo(w); err != nil {
+		log.Printf("Failed to write view: %v", err)
+	}
+}
+
+// versionHandler returns the build information of the running server.
+func versionHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(map[string]string{
+		"version":   version,
+		"commit":    commit,
+		"goVersion": runtime.Version(),
+	})
+	if err != nil {
+		log.Printf("Failed to write version: %v", err)
 	}
 }
 
 func websocketHandler(ws *websocket.Conn) {
 	for {
 		var err error
-		var url string
+		var message string
 
-		if err = websocket.Message.Receive(ws, &url); err != nil {
+		if err = websocket.Message.Receive(ws, &message); err != nil {
 			log.Printf("couldn't receive websocket message %v", err)
 			break
 		}
 
-		_, err = NewHTTPClient().Get(url)
+		request, err := parseAnalyzeRequest(message)
 		if err != nil {
 			ResponseFailure(ws, err.Error())
 			continue
 		}
-
-		rawHTML, err := getHTML(url)
-		if err != nil {
+		if err = checkDomain(request.URL); err != nil {
 			ResponseFailure(ws, err.Error())
 			continue
 		}
 
-		document, err := getDocument(rawHTML)
-		if err != nil {
-			ResponseFailure(ws, err.Error())
+		responder := newResponder(ws, requestLocale(ws, request))
+		start := time.Now()
+		accessURL := request.URL
+		var completed bool
+		switch {
+		case request.Type == requestTypeHTML:
+			completed = analyzeHTML(responder, request)
+		case request.Type == requestTypeValidate:
+			completed = validate(responder, request)
+		case request.Type == requestTypeRerun:
+			if cached, ok := cachedAnalysisOf(request.ID); ok {
+				accessURL = cached.requestURL
+			}
+			completed = rerun(responder, request)
+		case request.Type == requestTypeBatch:
+			// each url of a batch is logged as it's analyzed.
+			analyzeBatch(responder, request)
 			continue
+		case request.isFile():
+			completed = analyzeFile(responder, request)
+		default:
+			completed = analyze(responder, request)
 		}
+		logAccess(ws, responder.id, accessURL, completed, time.Since(start))
+	}
+}
 
-		analyzer := NewAnalyzer(ws, url, rawHTML, document)
-		analyzer.Start()
-		analyzer.Wait()
-		analyzer.Complete()
+// accessLog records each analysis. Its logger is nil unless ANALYZER_ACCESS_LOG is set.
+var accessLog = struct {
+	sync.Mutex
+	logger *log.Logger
+}{}
+
+// setAccessLog makes logger record each analysis, or disables the access log if nil.
+func setAccessLog(logger *log.Logger) {
+	accessLog.Lock()
+	defer accessLog.Unlock()
+	accessLog.logger = logger
+}
+
+// openAccessLog opens the access log at ANALYZER_ACCESS_LOG, which is a file path
+// or "stdout". The access log is disabled when it isn't set.
+func openAccessLog() error {
+	path := getEnv("ANALYZER_ACCESS_LOG", "")
+	switch path {
+	case "":
+		return nil
+	case "stdout":
+		setAccessLog(log.New(os.Stdout, "", 0))
+		return nil
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.Wrap(err, "Failed to open access log")
 	}
+	setAccessLog(log.New(file, "", 0))
+	return nil
 }
 
-func main() {
-	defer func(driver *agouti.WebDriver) {
-		err := driver.Stop()
-		if err != nil {
-			log.Printf("Failed to stop the service. please contact admin: %v", err)
-			os.Exit(1)
+type accessLogEntry struct {
+	Time     string `json:"time"`
+	ID       string `json:"id"`
+	URL      string `json:"url"`
+	ClientIP string `json:"clientIp"`
+	Status   string `json:"status"`
+	Duration string `json:"duration"`
+}
+
+// logAccess writes an access log line for an analysis as JSON.
+func logAccess(ws *websocket.Conn, id string, rawURL string, completed bool, duration time.Duration) {
+	accessLog.Lock()
+	logger := accessLog.logger
+	accessLog.Unlock()
+	if logger == nil {
+		return
+	}
+
+	entry := accessLogEntry{
+		Time:     time.Now().UTC().Format(time.RFC3339),
+		ID:       id,
+		URL:      rawURL,
+		Status:   "failure",
+		Duration: duration.Round(time.Millisecond).String(),
+	}
+	if completed {
+		entry.Status = "complete"
+	}
+	if ws.Request() != nil {
+		entry.ClientIP = ws.Request().RemoteAddr
+		if host, _, err := net.SplitHostPort(entry.ClientIP); err == nil {
+			entry.ClientIP = host
 		}
-	}(driver)
-	http.HandleFunc("/", index)
-	http.Handle("/webSocket", websocket.Handler(websocketHandler))
-	if err := http.ListenAndServe(fmt.Sprintf(":%s", webSocketPort()), nil); err != nil {
-		log.Printf("Failed to start the service. please contact admin: %v", err)
-		os.Exit(1)
 	}
-}
 
-func NewHTTPClient() *http.Client {
-	return &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true,
-			},
-		},
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("[%s] couldn't write access log %v", id, err)
+		return
 	}
+	logger.Println(string(line))
 }
 
-type analyzeResponseStatus int
+// analyzeHTML runs the document checks on html supplied by client,
+// without fetching or rendering anything.
+func analyzeHTML(responder *responder, request analyzeRequest) bool {
+	log.Printf("[%s] analyzing supplied html", responder.id)
 
-const (
-	statusSuccess analyzeResponseStatus = iota
-	statusFailure
-	statusComplete
-)
+	document, err := getDocument(request.HTML, "")
+	if err != nil {
+		responder.failure(err.Error())
+		return false
+	}
 
-type analyzeResponse struct {
-	Result string
-	Status analyzeResponseStatus
+	analyzer := NewAnalyzer(responder, request.URL, request.HTML, document)
+	analyzer.offline = true
+	analyzer.contentSelector = request.ContentSelector
+	analyzer.failFast = request.FailFast
+	analyzer.origin = request
+	analyzer.cache("")
+	analyzer.Start()
+	analyzer.Wait()
+	analyzer.Complete()
+	return !analyzer.stopped()
 }
 
-// ResponseSuccess returns success response to client.
-func ResponseSuccess(ws *websocket.Conn, message string) {
-	writeResponse(ws, message, statusSuccess)
-}
+// validate checks that a url can be analyzed with the preflight request only,
+// without rendering it or running any checks.
+func validate(responder *responder, request analyzeRequest) bool {
+	log.Printf("[%s] validating %s", responder.id, request.URL)
 
-// ResponseFailure returns failure response to client.
-func ResponseFailure(ws *websocket.Conn, message string) {
-	writeResponse(ws, message, statusFailure)
-}
+	response, _, err := preflight(request)
+	if err != nil {
+		responder.failure(err.Error())
+		return false
+	}
+	response.Body.Close()
 
-// ResponseComplete returns complete response to client.
-func ResponseComplete(ws *websocket.Conn, message string) {
-	writeResponse(ws, message, statusComplete)
-}
+	responder.success(fmt.Sprintf("status code : %d", response.StatusCode))
+	responder.success(fmt.Sprintf("content type : %s", html.EscapeString(response.Header.Get("Content-Type"))))
+	if redirects := redirectsOf(response); len(redirects) > 0 {
+		responder.success(fmt.Sprintf("redirects : %d (%s)", len(redirects), html.EscapeString(strings.Join(redirects, " -> "))))
+	} else {
+		responder.success("redirects : 0")
+	}
 
-func writeResponse(ws *websocket.Conn, message string, status analyzeResponseStatus) {
-	if err := websocket.JSON.Send(ws, analyzeResponse{Result: message, Status: status}); err != nil {
-		log.Printf("couldn't send websocket response %v", err)
+	if err = checkContentType(response); err != nil {
+		responder.failure(err.Error())
+		return false
 	}
+	if response.StatusCode >= http.StatusBadRequest {
+		responder.failure(fmt.Sprintf("unexpected status code: %d", response.StatusCode))
+		return false
+	}
+	responder.respond("validation completed : url can be analyzed", statusComplete)
+	return true
 }
 
-// Analyzer represents analyzer of web pages.
-type Analyzer struct {
-	waitGroup  *sync.WaitGroup
-	ws         *websocket.Conn
-	requestURL string
-	rawHTML    string
-	document   *goquery.Document
+// rerun runs the named checks of a prior analysis again, on its cached html,
+// for checks which failed transiently.
+func rerun(responder *responder, request analyzeRequest) bool {
+	log.Printf("[%s] rerunning %s of %s", responder.id, strings.Join(request.Checks, ", "), request.ID)
 
-	internalLink int
-	externalLink int
+	cached, ok := cachedAnalysisOf(request.ID)
+	if !ok {
+		responder.failure(fmt.Sprintf("analysis not found or expired: %s", html.EscapeString(request.ID)))
+		return false
+	}
 
-	startTime      time.Time
-	processingTime time.Duration
-}
+	stopKeepalive := startKeepalive(responder, keepaliveInterval())
+	defer stopKeepalive()
 
-// NewAnalyzer returns new Analyzer.
-func NewAnalyzer(ws *websocket.Conn,
-	requestURL string,
-	rawHTML string,
-	document *goquery.Document) *Analyzer {
+	document, err := getDocument(cached.rawHTML, cached.contentType)
+	if err != nil {
+		responder.failure(err.Error())
+		return false
+	}
 
-	return &Analyzer{
-		ws:         ws,
-		rawHTML:    rawHTML,
-		document:   document,
-		requestURL: requestURL,
-		waitGroup:  &sync.WaitGroup{},
+	analyzer := NewAnalyzer(responder, cached.requestURL, cached.rawHTML, document)
+	analyzer.offline = cached.offline
+	analyzer.header = cached.header
+	analyzer.timing = cached.timing
+	analyzer.redirects = cached.redirects
+	analyzer.body = cached.body
+	analyzer.contentSelector = cached.contentSelector
+	analyzer.crawl = cached.crawl
+	// credentials aren't cached, those of the rerun request are sent instead.
+	analyzer.origin = cached.origin
+	analyzer.origin.Username = request.Username
+	analyzer.origin.Password = request.Password
+	analyzer.origin.Token = request.Token
+	analyzer.checks = map[string]bool{}
+	for _, check := range request.Checks {
+		analyzer.checks[check] = true
 	}
-}
+	analyzer.Start()
+	analyzer.Wait()
+	stopKeepalive()
 
-// Start starts analyzing web page.
-func (a *Analyzer) Start() {
-	a.startTime = time.Now()
-	a.concur(a.findTitle)
-	a.concur(a.findDocType)
-	for i := 1; i <= 6; i++ {
-		a.concur(a.findHeading(i))
+	known := map[string]bool{}
+	for _, check := range analyzerChecks {
+		known[check.name] = true
 	}
-	a.concur(a.findLinks)
-	a.concur(a.findLoginForm)
+	for _, check := range request.Checks {
+		switch {
+		case !known[check]:
+			responder.failure(fmt.Sprintf("unknown check: %s", html.EscapeString(check)))
+		case !analyzer.ran[check]:
+			responder.failure(fmt.Sprintf("check does not apply to the analysis: %s", html.EscapeString(check)))
+		}
+	}
+	if len(analyzer.ran) == 0 {
+		return false
+	}
+	responder.respond(fmt.Sprintf("rerun completed : total processing time %s", analyzer.processingTime), statusComplete)
+	return true
 }
 
-// Wait waits until end of analyzing web page.
-func (a *Analyzer) Wait() {
-	a.waitGroup.Wait()
-	a.processingTime = time.Since(a.startTime)
+// analyzeBatch analyzes each url of a batch request as an analysis of its own,
+// then reports the distribution of their analysis times.
+func analyzeBatch(responder *responder, request analyzeRequest) bool {
+	log.Printf("[%s] analyzing batch of %d urls", responder.id, len(request.URLs))
+
+	var durations []time.Duration
+	for _, pageURL := range request.URLs {
+		page := request
+		page.Type = requestTypeAnalyze
+		page.URL = pageURL
+		page.URLs = nil
+
+		pageResponder := newResponder(responder.ws, responder.locale)
+		if err := checkDomain(page.URL); err != nil {
+			pageResponder.failure(err.Error())
+			continue
+		}
+		start := time.Now()
+		completed := analyze(pageResponder, page)
+		logAccess(responder.ws, pageResponder.id, page.URL, completed, time.Since(start))
+		if completed {
+			durations = append(durations, time.Since(start))
+		}
+	}
+
+	if len(durations) == 0 {
+		responder.failure("batch failed: no url could be analyzed")
+		return false
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	round := func(d time.Duration) time.Duration { return d.Round(time.Millisecond) }
+	responder.respond(fmt.Sprintf("batch completed : %d of %d urls analyzed, min %s, median %s, p95 %s, max %s",
+		len(durations), len(request.URLs),
+		round(durations[0]), round(percentile(durations, 50)), round(percentile(durations, 95)), round(durations[len(durations)-1])),
+		statusComplete)
+	return true
 }
 
-// Complete sends response of complete of analyzing web page to client.
-func (a *Analyzer) Complete() {
-	ResponseComplete(a.ws, fmt.Sprintf("analyzing completed : total processing time %s", a.processingTime))
+// percentile returns the nearest-rank percentile p of sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
 }
 
-func (a *Analyzer) concur(f func()) {
-	a.waitGroup.Add(1)
-	go func() {
-		defer a.waitGroup.Done()
-		f()
-	}()
+// cachedAnalysis holds what is needed to rerun checks of an analysis without
+// fetching and rendering its page again. Its origin has no credentials.
+type cachedAnalysis struct {
+	requestURL      string
+	rawHTML         string
+	contentType     string
+	header          http.Header
+	timing          *requestTiming
+	redirects       []string
+	body            []byte
+	offline         bool
+	contentSelector string
+	crawl           bool
+	origin          analyzeRequest
+	expires         time.Time
 }
 
-func (a *Analyzer) findDocType() {
-	firstline := strings.Split(a.rawHTML, "\n")[0]
-	r, _ := regexp.Compile("<!DOCTYPE(.*?)>")
-	match := r.FindString(firstline)
-	ResponseSuccess(a.ws, fmt.Sprintf("html version : %s", html.EscapeString(match)))
+// analysisCache holds recent analyses by id, oldest first in order.
+var analysisCache = struct {
+	sync.Mutex
+	entries map[string]cachedAnalysis
+	order   []string
+}{entries: map[string]cachedAnalysis{}}
+
+// cache keeps the html of the analysis for ANALYZER_RERUN_TTL, so its checks can be
+// rerun. Reruns are opt-in: at most ANALYZER_RERUN_CACHE_SIZE analyses are kept,
+// none by default. Credentials of the analysis are never kept.
+func (a *Analyzer) cache(contentType string) {
+	size := getEnvInt("ANALYZER_RERUN_CACHE_SIZE", 0)
+	if size <= 0 {
+		return
+	}
+	origin := a.origin
+	origin.Username, origin.Password, origin.Token = "", "", ""
+
+	analysisCache.Lock()
+	defer analysisCache.Unlock()
+
+	now := time.Now()
+	analysisCache.entries[a.id] = cachedAnalysis{
+		requestURL:      a.requestURL,
+		rawHTML:         a.rawHTML,
+		contentType:     contentType,
+		header:          a.header,
+		timing:          a.timing,
+		redirects:       a.redirects,
+		body:            a.body,
+		offline:         a.offline,
+		contentSelector: a.contentSelector,
+		crawl:           a.crawl,
+		origin:          origin,
+		expires:         now.Add(getEnvDuration("ANALYZER_RERUN_TTL", 10*time.Minute)),
+	}
+	analysisCache.order = append(analysisCache.order, a.id)
+
+	for len(analysisCache.order) > 0 {
+		oldest := analysisCache.order[0]
+		if len(analysisCache.order) <= size && now.Before(analysisCache.entries[oldest].expires) {
+			break
+		}
+		delete(analysisCache.entries, oldest)
+		analysisCache.order = analysisCache.order[1:]
+	}
 }
 
-func (a *Analyzer) findTitle() {
-	value := a.document.Find("title").Text()
-	ResponseSuccess(a.ws, fmt.Sprintf("title : %s", html.EscapeString(value)))
+func cachedAnalysisOf(id string) (cachedAnalysis, bool) {
+	analysisCache.Lock()
+	defer analysisCache.Unlock()
+
+	cached, ok := analysisCache.entries[id]
+	if !ok || time.Now().After(cached.expires) {
+		return cachedAnalysis{}, false
+	}
+	return cached, true
 }
 
-func (a *Analyzer) findHeading(level int) func() {
-	return func() {
-		var value int
-		findLevel := fmt.Sprintf("h%d", level)
-		a.document.Find(findLevel).Each(func(_ int, _ *goquery.Selection) { value++ })
-		ResponseSuccess(a.ws, fmt.Sprintf("%s count : %d", findLevel, value))
+// redirectsOf returns the urls response was redirected through, in order,
+// ending with the url of response itself.
+func redirectsOf(response *http.Response) []string {
+	var redirects []string
+	for request := response.Request; request != nil && request.Response != nil; request = request.Response.Request {
+		redirects = append([]string{request.URL.String()}, redirects...)
 	}
+	return redirects
 }
 
-func (a *Analyzer) findLinks() {
-	ignoreList := map[string]bool{}
+// analyzeFile analyzes a local html file, rendered by Chrome unless the request is static.
+func analyzeFile(responder *responder, request analyzeRequest) bool {
+	log.Printf("[%s] analyzing %s", responder.id, request.URL)
 
-	a.document.Find("a[href]").Each(func(_ int, s *goquery.Selection) {
-		link, _ := s.Attr("href")
-		if ignoreList[link] {
-			return
+	parsedURL, err := url.Parse(request.URL)
+	if err != nil {
+		responder.failure(err.Error())
+		return false
+	}
+	file, err := os.Open(parsedURL.Path)
+	if err != nil {
+		responder.failure(errors.Wrap(err, "Failed to open file").Error())
+		return false
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(io.LimitReader(file, maxBodyBytes()))
+	if err != nil {
+		responder.failure(errors.Wrap(err, "Failed to read file").Error())
+		return false
+	}
+
+	rawHTML := string(content)
+	if !request.Static {
+		size, err := parseDevice(request.Device)
+		if err != nil {
+			responder.failure(err.Error())
+			return false
+		}
+		if rawHTML, err = getHTML(request.URL, size, responder.progress); err != nil {
+			responder.failure(err.Error())
+			return false
 		}
+	}
 
-		ignoreList[link] = true
+	document, err := getDocument(rawHTML, "")
+	if err != nil {
+		responder.failure(err.Error())
+		return false
+	}
 
-		parsedURL, err := url.ParseRequestURI(link)
+	analyzer := NewAnalyzer(responder, request.URL, rawHTML, document)
+	analyzer.offline = true
+	analyzer.body = content
+	analyzer.contentSelector = request.ContentSelector
+	analyzer.failFast = request.FailFast
+	analyzer.origin = request
+	analyzer.cache("")
+	analyzer.Start()
+	analyzer.Wait()
+	analyzer.Complete()
+	return !analyzer.stopped()
+}
+
+// analyze fetches, renders and analyzes the url of request. Like the other
+// analysis functions, it reports whether the analysis completed.
+func analyze(responder *responder, request analyzeRequest) bool {
+	log.Printf("[%s] analyzing %s", responder.id, request.URL)
+
+	stopKeepalive := startKeepalive(responder, keepaliveInterval())
+	defer stopKeepalive()
+
+	response, timing, err := preflight(request)
+	if err != nil {
+		responder.failure(err.Error())
+		return false
+	}
+	defer response.Body.Close()
+
+	if err = checkContentType(response); err != nil {
+		responder.failure(err.Error())
+		return false
+	}
+
+	body, truncated, err := readBody(response)
+	if err != nil {
+		responder.failure(err.Error())
+		return false
+	}
+	if truncated {
+		responder.warning(fmt.Sprintf("response body truncated at %d bytes", len(body)))
+	}
+	responder.success(fmt.Sprintf("html size : %d bytes", len(body)))
+
+	rawHTML := string(body)
+	if !request.Static {
+		responder.progress("fetching...")
+		size, err := parseDevice(request.Device)
 		if err != nil {
-			return
+			responder.failure(err.Error())
+			return false
 		}
 
-		if parsedURL.Host == "" {
-			a.internalLink++
-		} else {
-			a.externalLink++
+		if rawHTML, err = getHTML(request.browserURL(), size, responder.progress); err != nil {
+			responder.failure(strings.ReplaceAll(err.Error(), request.browserURL(), request.URL))
+			return false
 		}
-	})
+	}
 
-	ResponseSuccess(a.ws, fmt.Sprintf("internal link count : %d", a.internalLink))
-	ResponseSuccess(a.ws, fmt.Sprintf("external link count : %d", a.externalLink))
-}
+	document, err := getDocument(rawHTML, response.Header.Get("Content-Type"))
+	if err != nil {
+		responder.failure(err.Error())
+		return false
+	}
 
-func (a *Analyzer) findLoginForm() {
-	var loginFound bool
-	a.document.Find("form").Each(func(_ int, s *goquery.Selection) {
-		action, _ := s.Attr("action")
-		if strings.Contains(action, "login") {
-			loginFound = true
+	analyzer := NewAnalyzer(responder, request.URL, rawHTML, document)
+	analyzer.header = response.Header
+	analyzer.timing = timing
+	analyzer.redirects = redirectsOf(response)
+	analyzer.body = body
+	analyzer.contentSelector = request.ContentSelector
+	analyzer.failFast = request.FailFast
+	analyzer.origin = request
+	analyzer.crawl = request.Crawl
+	analyzer.cache(response.Header.Get("Content-Type"))
+	if request.Diff && !request.Static {
+		if analyzer.staticDocument, err = getDocument(string(body), response.Header.Get("Content-Type")); err != nil {
+			responder.warning(fmt.Sprintf("render diff : %s", html.EscapeString(err.Error())))
 		}
-	})
-	ResponseSuccess(a.ws, fmt.Sprintf("contain login form : %s", strconv.FormatBool(loginFound)))
+	}
+	analyzer.Start()
+	analyzer.Wait()
+	stopKeepalive()
+	analyzer.Complete()
+	return !analyzer.stopped()
+}
+
+// requestTiming holds timings of a request, measured with httptrace. When the
+// request is redirected, they are the timings of the final hop.
+type requestTiming struct {
+	mutex sync.Mutex
+	start time.Time
+
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+
+	dns        time.Duration
+	connect    time.Duration
+	tls        time.Duration
+	firstByte  time.Duration
+	reusedConn bool
+	// gotConn ignores dials the transport goes on with after handing the
+	// request an idle connection.
+	gotConn bool
+}
+
+func (t *requestTiming) trace() *httptrace.ClientTrace {
+	record := func(f func()) {
+		t.mutex.Lock()
+		defer t.mutex.Unlock()
+		f()
+	}
+	recordDial := func(f func()) {
+		record(func() {
+			if !t.gotConn {
+				f()
+			}
+		})
+	}
+
+	return &httptrace.ClientTrace{
+		// each hop of a redirect gets a connection, which starts its timings over.
+		GetConn: func(string) {
+			record(func() {
+				t.start = time.Now()
+				t.dnsStart, t.connectStart, t.tlsStart = time.Time{}, time.Time{}, time.Time{}
+				t.dns, t.connect, t.tls, t.firstByte = 0, 0, 0, 0
+				t.reusedConn, t.gotConn = false, false
+			})
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			recordDial(func() { t.dnsStart = time.Now() })
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			recordDial(func() { t.dns = time.Since(t.dnsStart) })
+		},
+		ConnectStart: func(_, _ string) {
+			recordDial(func() {
+				// dual stack dials may start more than one connection attempt.
+				if t.connectStart.IsZero() {
+					t.connectStart = time.Now()
+				}
+			})
+		},
+		ConnectDone: func(_, _ string, err error) {
+			recordDial(func() {
+				if err == nil {
+					t.connect = time.Since(t.connectStart)
+				}
+			})
+		},
+		TLSHandshakeStart: func() {
+			recordDial(func() { t.tlsStart = time.Now() })
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			recordDial(func() { t.tls = time.Since(t.tlsStart) })
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			record(func() {
+				t.reusedConn, t.gotConn = info.Reused, true
+				if info.Reused {
+					t.dns, t.connect, t.tls = 0, 0, 0
+				}
+			})
+		},
+		GotFirstResponseByte: func() {
+			record(func() { t.firstByte = time.Since(t.start) })
+		},
+	}
+}
+
+// preflight requests the url of request before it is rendered, measuring the request timing.
+func preflight(request analyzeRequest) (*http.Response, *requestTiming, error) {
+	httpRequest, err := http.NewRequest(http.MethodGet, request.URL, nil)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Failed to create request")
+	}
+	request.authorize(httpRequest)
+	if request.Referer != "" {
+		httpRequest.Header.Set("Referer", request.Referer)
+	}
+
+	timing := &requestTiming{start: time.Now()}
+	httpRequest = httpRequest.WithContext(httptrace.WithClientTrace(httpRequest.Context(), timing.trace()))
+	response, err := NewHTTPClient().Do(httpRequest)
+	if err != nil {
+		return nil, nil, err
+	}
+	return response, timing, nil
+}
+
+func maxBodyBytes() int64 {
+	return int64(getEnvInt("ANALYZER_MAX_BODY_BYTES", 10*1024*1024))
+}
+
+// readBody reads the body of response up to ANALYZER_MAX_BODY_BYTES.
+// truncated reports whether the body was longer than that.
+func readBody(response *http.Response) (body []byte, truncated bool, err error) {
+	limit := maxBodyBytes()
+	body, err = io.ReadAll(io.LimitReader(response.Body, limit+1))
+	if err != nil {
+		return nil, false, errors.Wrap(err, "Failed to read response body")
+	}
+	if int64(len(body)) > limit {
+		return body[:limit], true, nil
+	}
+	return body, false, nil
+}
+
+func keepaliveInterval() time.Duration {
+	return getEnvDuration("ANALYZER_KEEPALIVE_INTERVAL", 15*time.Second)
+}
+
+// startKeepalive periodically sends keepalive messages so that proxies don't close
+// an idle connection during a long analysis. The returned function stops it.
+// An interval of zero or less disables keepalives.
+func startKeepalive(responder *responder, interval time.Duration) func() {
+	if interval <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				responder.keepalive()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-stopped
+		})
+	}
+}
+
+const (
+	requestTypeAnalyze  = "analyze"
+	requestTypeHTML     = "html"
+	requestTypeValidate = "validate"
+	requestTypeRerun    = "rerun"
+	requestTypeBatch    = "batch"
+)
+
+// analyzeRequest represents a message received from client.
+type analyzeRequest struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+	// HTML is the document to analyze for html requests. URL is then optional
+	// and only used to resolve relative links.
+	HTML string `json:"html"`
+	// Locale selects the language of results, overriding the Accept-Language
+	// header of the websocket handshake.
+	Locale string `json:"locale"`
+	// ContentSelector selects the main content of the page for content checks,
+	// instead of the main or article element.
+	ContentSelector string `json:"contentSelector"`
+
+	// Credentials for protected pages, either basic auth or a bearer token.
+	// They must never be logged.
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Token    string `json:"token"`
+
+	// Device is the device profile, mobile, tablet or desktop, or window size
+	// such as "1280x720" pages are rendered with.
+	Device string `json:"device"`
+
+	// Static analyzes the html as served, without rendering it in Chrome.
+	Static bool `json:"static"`
+
+	// Diff compares the rendered page with the html as served and reports
+	// what JavaScript changed.
+	Diff bool `json:"diff"`
+
+	// Crawl also fetches the internal links of the page, one level deep,
+	// and reports how many of them are broken.
+	Crawl bool `json:"crawl"`
+
+	// ID and Checks name a prior analysis and the checks of it to rerun,
+	// for rerun requests.
+	ID     string   `json:"id"`
+	Checks []string `json:"checks"`
+
+	// FailFast stops the analysis at the first check that fails, for CI gating.
+	FailFast bool `json:"failFast"`
+
+	// URLs are the pages of batch requests, analyzed one after another
+	// with the other options of the request.
+	URLs []string `json:"urls"`
+
+	// Referer is sent with the preflight request. Chrome navigates without one,
+	// since webdriver can't set request headers.
+	Referer string `json:"referer"`
+}
+
+func (r analyzeRequest) isFile() bool {
+	return strings.HasPrefix(strings.ToLower(r.URL), "file:")
+}
+
+// authorize applies the credentials of the request to httpRequest.
+func (r analyzeRequest) authorize(httpRequest *http.Request) {
+	switch {
+	case r.Token != "":
+		httpRequest.Header.Set("Authorization", "Bearer "+r.Token)
+	case r.Username != "":
+		httpRequest.SetBasicAuth(r.Username, r.Password)
+	}
+}
+
+// browserURL returns the url Chrome navigates to. Chrome can't be given request headers,
+// so basic auth credentials are embedded in the url and bearer tokens aren't sent.
+func (r analyzeRequest) browserURL() string {
+	if r.Username == "" {
+		return r.URL
+	}
+	parsedURL, err := url.Parse(r.URL)
+	if err != nil {
+		return r.URL
+	}
+	parsedURL.User = url.UserPassword(r.Username, r.Password)
+	return parsedURL.String()
+}
+
+// parseAnalyzeRequest parses a JSON envelope, or a plain url for backward compatibility.
+func parseAnalyzeRequest(message string) (analyzeRequest, error) {
+	message = strings.TrimSpace(message)
+
+	request := analyzeRequest{Type: requestTypeAnalyze}
+	if !strings.HasPrefix(message, "{") {
+		request.URL = message
+	} else {
+		if err := json.Unmarshal([]byte(message), &request); err != nil {
+			return analyzeRequest{}, errors.Wrap(err, "malformed message")
+		}
+		if request.Type == "" {
+			request.Type = requestTypeAnalyze
+		}
+	}
+
+	switch request.Type {
+	case requestTypeAnalyze, requestTypeValidate:
+	case requestTypeRerun:
+		if request.ID == "" || len(request.Checks) == 0 {
+			return analyzeRequest{}, errors.New("malformed message: expected id and checks")
+		}
+		return request, nil
+	case requestTypeBatch:
+		if len(request.URLs) == 0 {
+			return analyzeRequest{}, errors.New("malformed message: expected urls")
+		}
+		if limit := getEnvInt("ANALYZER_MAX_BATCH_URLS", 20); len(request.URLs) > limit {
+			return analyzeRequest{}, errors.Errorf("malformed message: at most %d urls can be analyzed at once", limit)
+		}
+		for _, batchURL := range request.URLs {
+			if !isHTTPURL(batchURL) {
+				return analyzeRequest{}, errors.New("malformed message: expected http or https urls")
+			}
+		}
+		return request, nil
+	case requestTypeHTML:
+		if strings.TrimSpace(request.HTML) == "" {
+			return analyzeRequest{}, errors.New("malformed message: expected html")
+		}
+		return request, nil
+	default:
+		return analyzeRequest{}, errors.Errorf("unsupported message type: %s", html.EscapeString(request.Type))
+	}
+
+	parsedURL, err := url.ParseRequestURI(request.URL)
+	if err == nil && parsedURL.Scheme == "file" && request.Type == requestTypeAnalyze && fileURLsAllowed() {
+		return request, nil
+	}
+	if !isHTTPURL(request.URL) {
+		return analyzeRequest{}, errors.New("malformed message: expected an http or https url")
+	}
+	return request, nil
+}
+
+func isHTTPURL(rawURL string) bool {
+	parsedURL, err := url.ParseRequestURI(rawURL)
+	return err == nil && parsedURL.Host != "" && (parsedURL.Scheme == "http" || parsedURL.Scheme == "https")
+}
+
+// checkDomain returns an error if the host of rawURL is denied by
+// ANALYZER_DENIED_DOMAINS, or missing from ANALYZER_ALLOWED_DOMAINS when that is set.
+// Domains may contain wildcards such as *.example.com, and denied domains take precedence.
+func checkDomain(rawURL string) error {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil || parsedURL.Host == "" {
+		// supplied html and file urls aren't fetched from a domain.
+		return nil
+	}
+	// a fully qualified name with a trailing dot is the same host.
+	host := strings.TrimSuffix(strings.ToLower(parsedURL.Hostname()), ".")
+
+	matches := func(domains []string) bool {
+		for _, domain := range domains {
+			if matched, _ := path.Match(strings.TrimSuffix(domain, "."), host); matched {
+				return true
+			}
+		}
+		return false
+	}
+	if matches(getEnvList("ANALYZER_DENIED_DOMAINS")) {
+		return errors.Errorf("domain not allowed: %s", html.EscapeString(host))
+	}
+	if allowed := getEnvList("ANALYZER_ALLOWED_DOMAINS"); len(allowed) > 0 && !matches(allowed) {
+		return errors.Errorf("domain not allowed: %s", html.EscapeString(host))
+	}
+	return nil
+}
+
+// fileURLsAllowed reports whether local files may be analyzed. It is off by default
+// so that a deployed server doesn't expose its file system.
+func fileURLsAllowed() bool {
+	return getEnvBool("ANALYZER_ALLOW_FILE_URLS", false)
+}
+
+func requestLocale(ws *websocket.Conn, request analyzeRequest) string {
+	var acceptLanguage string
+	if ws.Request() != nil {
+		acceptLanguage = ws.Request().Header.Get("Accept-Language")
+	}
+	return resolveLocale(request.Locale, acceptLanguage)
+}
+
+// checkContentType returns an error unless the response is an HTML document.
+// A missing Content-Type is accepted, since the browser will sniff it.
+func checkContentType(response *http.Response) error {
+	contentType := response.Header.Get("Content-Type")
+	if contentType == "" {
+		return nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return errors.Wrap(err, "Failed to parse content type")
+	}
+
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return errors.Errorf("unsupported content type: %s", mediaType)
+	}
+	return nil
+}
+
+func main() {
+	var err error
+	if indexTemplate, err = parseIndex(); err != nil {
+		log.Printf("Failed to parse view: %v", err)
+		os.Exit(1)
+	}
+	if err = openAccessLog(); err != nil {
+		log.Printf("Failed to open access log: %v", err)
+		os.Exit(1)
+	}
+	if err = Setup(); err != nil {
+		log.Printf("Failed to start driver. please restart server: %v", err)
+		os.Exit(1)
+	}
+	defer func(driver *agouti.WebDriver) {
+		err := driver.Stop()
+		if err != nil {
+			log.Printf("Failed to stop the service. please contact admin: %v", err)
+			os.Exit(1)
+		}
+	}(driver)
+	http.HandleFunc("/", index)
+	http.HandleFunc("/version", versionHandler)
+	http.Handle("/webSocket", websocket.Handler(websocketHandler))
+	if err := http.ListenAndServe(fmt.Sprintf(":%s", webSocketPort()), nil); err != nil {
+		log.Printf("Failed to start the service. please contact admin: %v", err)
+		os.Exit(1)
+	}
+}
+
+var (
+	transport     *http.Transport
+	transportOnce sync.Once
+)
+
+// sharedTransport returns the transport all HTTP clients share, so that
+// connections are pooled and reused across requests.
+func sharedTransport() *http.Transport {
+	transportOnce.Do(func() {
+		transport = &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+			},
+			MaxIdleConns:        getEnvInt("ANALYZER_MAX_IDLE_CONNS", 100),
+			MaxIdleConnsPerHost: getEnvInt("ANALYZER_MAX_IDLE_CONNS_PER_HOST", 10),
+			IdleConnTimeout:     getEnvDuration("ANALYZER_IDLE_CONN_TIMEOUT", 90*time.Second),
+			ForceAttemptHTTP2:   getEnvBool("ANALYZER_FORCE_HTTP2", true),
+		}
+	})
+	return transport
+}
+
+// NewHTTPClient returns a client on the shared transport. Callers may set its
+// timeout, the connection pool is shared.
+func NewHTTPClient() *http.Client {
+	return &http.Client{Transport: sharedTransport(), CheckRedirect: checkRedirect}
+}
+
+// checkRedirect follows up to 10 redirects, like the default policy, but not
+// to domains the server may not analyze, so allowed hosts can't redirect to them.
+func checkRedirect(request *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	return checkDomain(request.URL.String())
+}
+
+// Responses are modeled by the client package, so Go clients can decode them.
+type analyzeResponseStatus = client.Status
+
+const (
+	statusSuccess   = client.StatusSuccess
+	statusFailure   = client.StatusFailure
+	statusComplete  = client.StatusComplete
+	statusProgress  = client.StatusProgress
+	statusKeepalive = client.StatusKeepalive
+	statusWarning   = client.StatusWarning
+)
+
+type analyzeResponse = client.Response
+
+// ResponseFailure returns failure response to client, for failures before an
+// analysis has started.
+func ResponseFailure(ws *websocket.Conn, message string) {
+	writeResponse(ws, message, statusFailure)
+}
+
+func writeResponse(ws *websocket.Conn, message string, status analyzeResponseStatus) {
+	sendResponse(ws, analyzeResponse{Result: message, Status: status})
+}
+
+func sendResponse(ws *websocket.Conn, response analyzeResponse) {
+	if err := websocket.JSON.Send(ws, response); err != nil {
+		log.Printf("[%s] couldn't send websocket response %v", response.ID, err)
+	}
+}
+
+// responder writes the responses of one analysis to client, tagged with the
+// analysis ID and translated into the locale of the analysis.
+// Once the results of an analysis exceed maxResults or maxResultBytes, further
+// results are dropped to protect slow clients.
+type responder struct {
+	ws     *websocket.Conn
+	id     string
+	locale string
+
+	mutex          sync.Mutex
+	maxResults     int
+	maxResultBytes int
+	results        int
+	resultBytes    int
+	truncated      bool
+}
+
+func newResponder(ws *websocket.Conn, locale string) *responder {
+	return &responder{
+		ws:             ws,
+		id:             newAnalysisID(),
+		locale:         locale,
+		maxResults:     getEnvInt("ANALYZER_MAX_RESULTS", 500),
+		maxResultBytes: getEnvInt("ANALYZER_MAX_RESULT_BYTES", 1024*1024),
+	}
+}
+
+// newAnalysisID returns a short random ID.
+func newAnalysisID() string {
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(id)
+}
+
+func (r *responder) success(message string) {
+	r.respond(message, statusSuccess)
+}
+
+func (r *responder) failure(message string) {
+	r.respond(message, statusFailure)
+}
+
+func (r *responder) warning(message string) {
+	r.respond(message, statusWarning)
+}
+
+func (r *responder) progress(message string) {
+	r.respond(message, statusProgress)
+}
+
+func (r *responder) keepalive() {
+	r.respond("", statusKeepalive)
+}
+
+func (r *responder) respond(message string, status analyzeResponseStatus) {
+	// the untranslated label lets clients tell results apart in any locale.
+	var label string
+	if parts := strings.SplitN(message, " : ", 2); len(parts) == 2 {
+		label = parts[0]
+	}
+	message = localize(r.locale, message)
+	if !r.admit(message, status) {
+		return
+	}
+	sendResponse(r.ws, analyzeResponse{ID: r.id, Label: label, Result: message, Status: status})
+}
+
+// admit reports whether a response may be sent within the result limits. Progress,
+// keepalive and complete responses are always sent. The first response over the
+// limits is replaced with a truncation notice.
+func (r *responder) admit(message string, status analyzeResponseStatus) bool {
+	if status == statusProgress || status == statusKeepalive || status == statusComplete {
+		return true
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.truncated {
+		return false
+	}
+
+	r.results++
+	r.resultBytes += len(message)
+	if r.results <= r.maxResults && r.resultBytes <= r.maxResultBytes {
+		return true
+	}
+
+	r.truncated = true
+	sendResponse(r.ws, analyzeResponse{ID: r.id, Result: localize(r.locale, "results truncated"), Status: statusWarning})
+	return false
+}
+
+// Analyzer represents analyzer of web pages.
+type Analyzer struct {
+	*responder
+
+	waitGroup  *sync.WaitGroup
+	requestURL string
+	rawHTML    string
+	document   *goquery.Document
+
+	// offline skips checks which need network access, for supplied html.
+	offline bool
+	// header holds the response headers of the page, if it was fetched.
+	header http.Header
+	// timing holds timings of the preflight request, if the page was fetched.
+	timing *requestTiming
+	// redirects holds the urls the preflight request was redirected through.
+	redirects []string
+	// body holds the page as served, before rendering, if it was fetched or read from a file.
+	body []byte
+	// contentSelector selects the main content of the page, overriding main and article.
+	contentSelector string
+	// staticDocument holds the html as served, before rendering, for diff requests.
+	staticDocument *goquery.Document
+	// crawl follows internal links one level deep, for crawl requests.
+	crawl bool
+	// checks limits the analysis to the named checks, for reruns, and ran records
+	// the checks started.
+	checks map[string]bool
+	ran    map[string]bool
+	// origin is the request the analysis was started by, whose credentials and
+	// referer are sent with the requests checks make.
+	origin analyzeRequest
+	// failFast stops the analysis at the first failing check by cancelling ctx.
+	// emitting serializes the results of checks with the cancellation.
+	failFast bool
+	ctx      context.Context
+	cancel   context.CancelFunc
+	emitting sync.Mutex
+
+	internalLink int
+	externalLink int
+
+	startTime      time.Time
+	processingTime time.Duration
+}
+
+// NewAnalyzer returns new Analyzer.
+func NewAnalyzer(responder *responder,
+	requestURL string,
+	rawHTML string,
+	document *goquery.Document) *Analyzer {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Analyzer{
+		responder:  responder,
+		rawHTML:    rawHTML,
+		document:   document,
+		requestURL: requestURL,
+		waitGroup:  &sync.WaitGroup{},
+		ran:        map[string]bool{},
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+}
+
+// stopped reports whether a fail-fast analysis stopped at a failing check.
+func (a *Analyzer) stopped() bool {
+	return a.ctx.Err() != nil
+}
+
+// success, warning and failure drop results of checks once the analysis stopped.
+func (a *Analyzer) success(message string) {
+	a.emit(func() { a.responder.success(message) })
+}
+
+func (a *Analyzer) warning(message string) {
+	a.emit(func() { a.responder.warning(message) })
+}
+
+// failure reports a failure of the named check, naming it so that clients can rerun it.
+func (a *Analyzer) failure(check, message string) {
+	if check != "" {
+		message += fmt.Sprintf(" (check %s)", check)
+	}
+	a.emit(func() {
+		a.responder.failure(message)
+		if a.failFast {
+			a.cancel()
+		}
+	})
+}
+
+// emit sends a result unless ctx is done. Results are sent one at a time, so no
+// result of another check follows the failure which stopped a fail-fast analysis.
+func (a *Analyzer) emit(send func()) {
+	a.emitting.Lock()
+	defer a.emitting.Unlock()
+	if a.ctx.Err() == nil {
+		send()
+	}
+}
+
+// analyzerCheck is a check of the analysis, by the name reruns and failures refer to it.
+type analyzerCheck struct {
+	name string
+	run  func(a *Analyzer)
+	// when, if set, reports whether the check applies to the analysis.
+	when func(a *Analyzer) bool
+}
+
+// online limits a check to analyses with network access.
+func online(a *Analyzer) bool {
+	return !a.offline
+}
+
+// analyzerChecks are the checks of an analysis, in the order they are started.
+var analyzerChecks = []analyzerCheck{
+	{name: "findTitle", run: (*Analyzer).findTitle},
+	{name: "findDocType", run: (*Analyzer).findDocType},
+	{name: "findHeading", run: func(a *Analyzer) {
+		for i := 1; i <= 6; i++ {
+			a.findHeading(i)()
+		}
+	}},
+	{name: "findLinks", run: (*Analyzer).findLinks},
+	{name: "findLoginForm", run: (*Analyzer).findLoginForm},
+	{name: "findThirdPartyDomains", run: (*Analyzer).findThirdPartyDomains},
+	{name: "findFonts", run: (*Analyzer).findFonts},
+	{name: "findAltTextQuality", run: (*Analyzer).findAltTextQuality},
+	{name: "findComments", run: (*Analyzer).findComments},
+	{name: "findPreloadHints", run: (*Analyzer).findPreloadHints},
+	{name: "findEmailAddresses", run: (*Analyzer).findEmailAddresses},
+	{name: "findDOMDepth", run: (*Analyzer).findDOMDepth},
+	{name: "findDuplicateIDs", run: (*Analyzer).findDuplicateIDs},
+	{name: "findTables", run: (*Analyzer).findTables},
+	{name: "findViewport", run: (*Analyzer).findViewport},
+	{name: "findInlineEventHandlers", run: (*Analyzer).findInlineEventHandlers},
+	{name: "findCSPViolations", run: (*Analyzer).findCSPViolations},
+	{name: "findResponsiveImages", run: (*Analyzer).findResponsiveImages},
+	{name: "findImageFormats", run: (*Analyzer).findImageFormats},
+	{name: "findNoscript", run: (*Analyzer).findNoscript},
+	{name: "findAbsoluteInternalLinks", run: (*Analyzer).findAbsoluteInternalLinks},
+	{name: "findPaginationLinks", run: (*Analyzer).findPaginationLinks},
+	{name: "findLargestContentfulElement", run: (*Analyzer).findLargestContentfulElement},
+	{name: "findTextToHTMLRatio", run: (*Analyzer).findTextToHTMLRatio},
+	{name: "findMetaCharsetPosition", run: (*Analyzer).findMetaCharsetPosition},
+	{name: "findPlatform", run: (*Analyzer).findPlatform},
+	{name: "findWordCount", run: (*Analyzer).findWordCount},
+	{name: "findExternalFormActions", run: (*Analyzer).findExternalFormActions},
+	{name: "findDataAttributes", run: (*Analyzer).findDataAttributes},
+	{name: "findSkipLink", run: (*Analyzer).findSkipLink},
+	{name: "findResourceSummary", run: (*Analyzer).findResourceSummary},
+	{name: "findPrivacyPolicyLink", run: (*Analyzer).findPrivacyPolicyLink},
+	{name: "findFormsWithoutAction", run: (*Analyzer).findFormsWithoutAction},
+	{name: "findInaccessibleImages", run: (*Analyzer).findInaccessibleImages},
+	{name: "findInlineImportant", run: (*Analyzer).findInlineImportant},
+	{name: "findMetaThemeColor", run: (*Analyzer).findMetaThemeColor},
+	{name: "findPWA", run: (*Analyzer).findPWA},
+	{name: "findPositiveTabindex", run: (*Analyzer).findPositiveTabindex},
+	{name: "findEmptyRender", run: (*Analyzer).findEmptyRender},
+	{name: "findUnsafeTargetBlank", run: (*Analyzer).findUnsafeTargetBlank},
+	{name: "findAutoplayMedia", run: (*Analyzer).findAutoplayMedia},
+	{name: "findRenderingMode", run: (*Analyzer).findRenderingMode},
+	{name: "findHTTPEquivHeaders", run: (*Analyzer).findHTTPEquivHeaders},
+	{name: "findDataURIs", run: (*Analyzer).findDataURIs},
+	{name: "findRenderDiff", run: (*Analyzer).findRenderDiff},
+	{name: "findEmptyElements", run: (*Analyzer).findEmptyElements},
+	{name: "findAppMetadata", run: (*Analyzer).findAppMetadata},
+	{name: "findAccessKeys", run: (*Analyzer).findAccessKeys},
+	{name: "findInlineScriptSize", run: (*Analyzer).findInlineScriptSize},
+	{name: "findSemanticStructure", run: (*Analyzer).findSemanticStructure},
+	{name: "findTrackingPixels", run: (*Analyzer).findTrackingPixels},
+	{name: "findDisabledFormControls", run: (*Analyzer).findDisabledFormControls},
+	{name: "findXUACompatible", run: (*Analyzer).findXUACompatible},
+	{name: "findSVGs", run: (*Analyzer).findSVGs},
+	{name: "findConsentBanner", run: (*Analyzer).findConsentBanner},
+	{name: "findInputAutocomplete", run: (*Analyzer).findInputAutocomplete},
+	{name: "findLongClassLists", run: (*Analyzer).findLongClassLists},
+	{name: "findRSSFeeds", run: (*Analyzer).findRSSFeeds},
+	{name: "findDoNotTrack", run: (*Analyzer).findDoNotTrack},
+	{name: "findMissingLangOnContent", run: (*Analyzer).findMissingLangOnContent},
+	{name: "findViewportUnits", run: (*Analyzer).findViewportUnits},
+	{name: "findSitemap", run: (*Analyzer).findSitemap, when: online},
+	{name: "findHTTPSUpgrade", run: (*Analyzer).findHTTPSUpgrade, when: online},
+	{name: "findTiming", run: (*Analyzer).findTiming, when: online},
+	{name: "findCompression", run: (*Analyzer).findCompression, when: online},
+	{name: "findImageSizes", run: (*Analyzer).findImageSizes, when: online},
+	{name: "findFavicon", run: (*Analyzer).findFavicon, when: online},
+	{name: "crawlLinks", run: (*Analyzer).crawlLinks, when: func(a *Analyzer) bool {
+		return online(a) && a.crawl
+	}},
+}
+
+// Start starts analyzing web page.
+func (a *Analyzer) Start() {
+	a.startTime = time.Now()
+	for _, check := range analyzerChecks {
+		if check.when == nil || check.when(a) {
+			a.concur(check)
+		}
+	}
+}
+
+// Wait waits until end of analyzing web page.
+func (a *Analyzer) Wait() {
+	a.waitGroup.Wait()
+	a.processingTime = time.Since(a.startTime)
+}
+
+// Complete sends response of complete of analyzing web page to client, also when
+// a fail-fast analysis stopped at a failing check.
+func (a *Analyzer) Complete() {
+	if a.stopped() {
+		a.respond(fmt.Sprintf("analysis stopped : a check failed in fail fast mode, total processing time %s", a.processingTime), statusComplete)
+		log.Printf("[%s] analysis stopped at a failing check", a.id)
+		return
+	}
+	score, failed := a.score()
+	if len(failed) > 0 {
+		a.success(fmt.Sprintf("score deductions : %s", strings.Join(failed, ", ")))
+	}
+	a.respond(fmt.Sprintf("analyzing completed : total processing time %s, score %d/100", a.processingTime, score), statusComplete)
+	log.Printf("[%s] analysis completed in %s", a.id, a.processingTime)
+}
+
+// scoreCriteria make up the summary score, each weighted out of a total of 100.
+var scoreCriteria = []struct {
+	name   string
+	weight int
+	passes func(a *Analyzer) bool
+}{
+	{"has title", 15, func(a *Analyzer) bool {
+		return strings.TrimSpace(a.document.Find("title").Text()) != ""
+	}},
+	{"has meta description", 15, func(a *Analyzer) bool {
+		return strings.TrimSpace(a.document.Find("meta[name='description']").AttrOr("content", "")) != ""
+	}},
+	{"has doctype", 10, func(a *Analyzer) bool {
+		return strings.HasPrefix(strings.ToLower(strings.TrimSpace(a.rawHTML)), "<!doctype")
+	}},
+	{"has one h1", 10, func(a *Analyzer) bool {
+		return a.document.Find("h1").Length() == 1
+	}},
+	{"images have alt text", 15, func(a *Analyzer) bool {
+		return a.document.Find("img:not([alt])").Length() == 0
+	}},
+	{"has viewport", 10, func(a *Analyzer) bool {
+		return a.document.Find("meta[name='viewport']").Length() > 0
+	}},
+	{"has lang attribute", 10, func(a *Analyzer) bool {
+		return strings.TrimSpace(a.document.Find("html").AttrOr("lang", "")) != ""
+	}},
+	{"no duplicate ids", 15, func(a *Analyzer) bool {
+		ids := map[string]bool{}
+		duplicate := false
+		a.document.Find("[id]").Each(func(_ int, s *goquery.Selection) {
+			id := s.AttrOr("id", "")
+			duplicate = duplicate || ids[id]
+			ids[id] = true
+		})
+		return !duplicate
+	}},
+}
+
+// score returns the summary score of the page and the names of the criteria it failed.
+func (a *Analyzer) score() (int, []string) {
+	var score int
+	var failed []string
+	for _, criterion := range scoreCriteria {
+		if criterion.passes(a) {
+			score += criterion.weight
+		} else {
+			failed = append(failed, criterion.name)
+		}
+	}
+	return score, failed
+}
+
+// concur runs check concurrently with the other checks, unless the analysis
+// stopped or a rerun left it out.
+func (a *Analyzer) concur(check analyzerCheck) {
+	if a.stopped() || (a.checks != nil && !a.checks[check.name]) {
+		return
+	}
+	a.ran[check.name] = true
+
+	a.waitGroup.Add(1)
+	go func() {
+		defer a.waitGroup.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("[%s] check %s panicked: %v\n%s", a.id, check.name, r, debug.Stack())
+				a.failure(check.name, fmt.Sprintf("check failed : %s", html.EscapeString(fmt.Sprint(r))))
+			}
+		}()
+		if !a.stopped() {
+			check.run(a)
+		}
+	}()
+}
+
+func (a *Analyzer) findDocType() {
+	firstline := strings.Split(a.rawHTML, "\n")[0]
+	r, _ := regexp.Compile("<!DOCTYPE(.*?)>")
+	match := r.FindString(firstline)
+	a.success(fmt.Sprintf("html version : %s", html.EscapeString(match)))
+}
+
+func (a *Analyzer) findTitle() {
+	value := a.document.Find("title").Text()
+	a.success(fmt.Sprintf("title : %s", html.EscapeString(value)))
+}
+
+func (a *Analyzer) findHeading(level int) func() {
+	return func() {
+		var value int
+		findLevel := fmt.Sprintf("h%d", level)
+		a.document.Find(findLevel).Each(func(_ int, _ *goquery.Selection) { value++ })
+		a.success(fmt.Sprintf("%s count : %d", findLevel, value))
+	}
+}
+
+// internalHosts returns hosts which are treated as internal in addition to the host
+// of the analyzed page, such as a www. variant or an asset host.
+func internalHosts() []string {
+	return getEnvList("ANALYZER_INTERNAL_HOSTS")
+}
+
+// isInternalHost reports whether links to host are internal to the analyzed page.
+// With ANALYZER_INTERNAL_SUBDOMAINS set, hosts under the same registrable domain
+// as the page, such as blog.example.com for example.com, are internal too.
+func (a *Analyzer) isInternalHost(host string) bool {
+	host = strings.ToLower(host)
+	page, err := url.Parse(a.requestURL)
+	if err == nil && host == strings.ToLower(page.Hostname()) {
+		return true
+	}
+	for _, internal := range internalHosts() {
+		if host == internal {
+			return true
+		}
+	}
+
+	if err != nil || !getEnvBool("ANALYZER_INTERNAL_SUBDOMAINS", false) {
+		return false
+	}
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return false
+	}
+	pageDomain, err := publicsuffix.EffectiveTLDPlusOne(strings.ToLower(page.Hostname()))
+	return err == nil && domain == pageDomain
+}
+
+func maxLinks() int {
+	return getEnvInt("ANALYZER_MAX_LINKS", 5000)
+}
+
+func (a *Analyzer) findLinks() {
+	ignoreList := map[string]bool{}
+	limit := maxLinks()
+	var truncated bool
+
+	links := a.document.Find("a[href]")
+	links.EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		link, _ := s.Attr("href")
+		if ignoreList[link] {
+			return true
+		}
+
+		if limit > 0 && len(ignoreList) >= limit {
+			truncated = true
+			return false
+		}
+		ignoreList[link] = true
+
+		parsedURL, err := url.ParseRequestURI(link)
+		if err != nil {
+			return true
+		}
+
+		if parsedURL.Host == "" || a.isInternalHost(parsedURL.Hostname()) {
+			a.internalLink++
+		} else {
+			a.externalLink++
+		}
+		return true
+	})
+
+	if truncated {
+		a.warning(fmt.Sprintf("link analysis truncated at %d links", limit))
+	}
+	a.success(fmt.Sprintf("internal link count : %d", a.internalLink))
+	a.success(fmt.Sprintf("external link count : %d", a.externalLink))
+	a.success(fmt.Sprintf("total links : %d, unique : %d", links.Length(), len(ignoreList)))
+}
+
+// findLoginForm looks for login forms in the document rendered by Chrome, so forms
+// injected by javascript are found, which parsing the served html alone would miss.
+func (a *Analyzer) findLoginForm() {
+	var loginFound bool
+	a.document.Find("form").Each(func(_ int, s *goquery.Selection) {
+		action, _ := s.Attr("action")
+		if strings.Contains(action, "login") {
+			loginFound = true
+		}
+	})
+	a.success(fmt.Sprintf("contain login form : %s", strconv.FormatBool(loginFound)))
+}
+
+func (a *Analyzer) findThirdPartyDomains() {
+	if _, err := url.Parse(a.requestURL); err != nil {
+		a.failure("findThirdPartyDomains", fmt.Sprintf("third party domains : %s", html.EscapeString(err.Error())))
+		return
+	}
+
+	domains := map[string]int{}
+	for _, resource := range a.subresourceURLs() {
+		if resource.Host == "" || a.isInternalHost(resource.Hostname()) {
+			continue
+		}
+		domains[strings.ToLower(resource.Hostname())]++
+	}
+
+	if len(domains) == 0 {
+		a.success("third party domains : 0")
+		return
+	}
+	a.success(fmt.Sprintf("third party domains : %d (%s)", len(domains), html.EscapeString(formatCounts(domains, 5))))
+}
+
+var (
+	fontFaceRule   = regexp.MustCompile(`(?is)@font-face\s*{([^}]*)}`)
+	fontFamilyDecl = regexp.MustCompile(`(?i)font-family\s*:\s*['"]?([^;'"]+)`)
+	fontSrcURL     = regexp.MustCompile(`(?i)url\(\s*['"]?([^'")]+)`)
+)
+
+func (a *Analyzer) findFonts() {
+	families := map[string]map[string]bool{}
+	add := func(host, family string) {
+		if families[host] == nil {
+			families[host] = map[string]bool{}
+		}
+		families[host][strings.TrimSpace(family)] = true
+	}
+
+	a.document.Find("link[href]").Each(func(_ int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+		resolved, err := a.resolveURL(href)
+		if err != nil {
+			return
+		}
+
+		if strings.EqualFold(resolved.Hostname(), "fonts.googleapis.com") {
+			for _, family := range resolved.Query()["family"] {
+				for _, name := range strings.Split(family, "|") {
+					add(resolved.Hostname(), strings.Split(name, ":")[0])
+				}
+			}
+			return
+		}
+
+		if strings.Contains(strings.ToLower(s.AttrOr("rel", "")), "preload") && strings.EqualFold(s.AttrOr("as", ""), "font") {
+			name := path.Base(resolved.Path)
+			add(resolved.Hostname(), strings.TrimSuffix(name, path.Ext(name)))
+		}
+	})
+
+	a.document.Find("style").Each(func(_ int, s *goquery.Selection) {
+		for _, rule := range fontFaceRule.FindAllStringSubmatch(s.Text(), -1) {
+			family := fontFamilyDecl.FindStringSubmatch(rule[1])
+			if family == nil {
+				continue
+			}
+
+			host := "inline"
+			if src := fontSrcURL.FindStringSubmatch(rule[1]); src != nil {
+				if resolved, err := a.resolveURL(src[1]); err == nil && resolved.Host != "" {
+					host = resolved.Hostname()
+				}
+			}
+			add(host, family[1])
+		}
+	})
+
+	if len(families) == 0 {
+		a.success("web fonts : none")
+		return
+	}
+
+	hosts := make([]string, 0, len(families))
+	for host := range families {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	summaries := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		summaries = append(summaries, fmt.Sprintf("%s (%d families)", host, len(families[host])))
+	}
+	a.success(fmt.Sprintf("web fonts : %s", html.EscapeString(strings.Join(summaries, ", "))))
+}
+
+const maxAltTextLength = 125
+
+var (
+	altTextFilename = regexp.MustCompile(`(?i)\.(jpe?g|png|gif|webp|avif|svg|bmp)$`)
+	altTextGeneric  = map[string]bool{"image": true, "photo": true, "picture": true, "img": true}
+)
+
+func (a *Analyzer) findAltTextQuality() {
+	var lowQuality int
+	a.document.Find("img[alt]").Each(func(_ int, s *goquery.Selection) {
+		alt := strings.TrimSpace(s.AttrOr("alt", ""))
+		if alt == "" {
+			return
+		}
+
+		if altTextFilename.MatchString(alt) || altTextGeneric[strings.ToLower(alt)] || len(alt) > maxAltTextLength {
+			lowQuality++
+		}
+	})
+	a.success(fmt.Sprintf("low-quality alt text : %d", lowQuality))
+
+	// an empty alt marks an image as decorative, only a missing one is a problem.
+	decorative := a.document.Find("img[alt='']").Length()
+	missing := a.document.Find("img:not([alt])").Length()
+	a.success(fmt.Sprintf("decorative images (empty alt) : %d, images missing alt : %d", decorative, missing))
+}
+
+var (
+	htmlComment        = regexp.MustCompile(`(?s)<!--(.*?)-->`)
+	conditionalComment = regexp.MustCompile(`(?i)^\s*\[if\s`)
+)
+
+func (a *Analyzer) findComments() {
+	var comments, conditional int
+	for _, match := range htmlComment.FindAllStringSubmatch(a.rawHTML, -1) {
+		comments++
+		if conditionalComment.MatchString(match[1]) {
+			conditional++
+		}
+	}
+	a.success(fmt.Sprintf("html comments : %d (conditional: %d)", comments, conditional))
+}
+
+const maxRobotsTxtBytes = 512 * 1024
+
+// fetchRobotsTxt returns the robots.txt of the host of the page, or an empty string
+// when the host doesn't serve one.
+func (a *Analyzer) fetchRobotsTxt() (string, error) {
+	parsedURL, err := url.Parse(a.requestURL)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to parse url")
+	}
+	robotsURL := url.URL{Scheme: parsedURL.Scheme, Host: parsedURL.Host, Path: "/robots.txt"}
+
+	client := NewHTTPClient()
+	client.Timeout = 10 * time.Second
+	response, err := a.request(client, http.MethodGet, robotsURL.String())
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to fetch robots.txt")
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxRobotsTxtBytes))
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to read robots.txt")
+	}
+	return string(body), nil
+}
+
+func (a *Analyzer) findSitemap() {
+	var sitemaps []string
+	seen := map[string]bool{}
+	add := func(sitemap string) {
+		if sitemap != "" && !seen[sitemap] {
+			seen[sitemap] = true
+			sitemaps = append(sitemaps, sitemap)
+		}
+	}
+
+	// without robots.txt, sitemaps linked from the page are still reported.
+	robots, err := a.fetchRobotsTxt()
+	if err != nil {
+		a.warning(fmt.Sprintf("robots.txt : %s", html.EscapeString(err.Error())))
+	}
+	for _, line := range strings.Split(robots, "\n") {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) == 2 && strings.EqualFold(strings.TrimSpace(parts[0]), "sitemap") {
+			add(strings.TrimSpace(parts[1]))
+		}
+	}
+
+	a.document.Find("link[rel='sitemap'][href]").Each(func(_ int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+		if resolved, err := a.resolveURL(href); err == nil {
+			add(resolved.String())
+		}
+	})
+
+	if len(sitemaps) == 0 {
+		a.success("sitemap : not found")
+		return
+	}
+	a.success(fmt.Sprintf("sitemap : %s", html.EscapeString(strings.Join(sitemaps, ", "))))
+}
+
+var resourceHints = []string{"preload", "prefetch", "preconnect", "dns-prefetch"}
+
+func (a *Analyzer) findPreloadHints() {
+	targets := map[string][]string{}
+	a.document.Find("link[rel][href]").Each(func(_ int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+		for _, rel := range strings.Fields(strings.ToLower(s.AttrOr("rel", ""))) {
+			targets[rel] = append(targets[rel], href)
+		}
+	})
+
+	var found bool
+	for _, hint := range resourceHints {
+		if len(targets[hint]) == 0 {
+			continue
+		}
+		found = true
+		a.success(fmt.Sprintf("%s hints : %d (%s)", hint, len(targets[hint]), html.EscapeString(strings.Join(targets[hint], ", "))))
+	}
+	if !found {
+		a.success("resource hints : none")
+	}
+}
+
+var (
+	emailAddress           = regexp.MustCompile(`(?i)[a-z0-9._%+-]+@[a-z0-9.-]+\.[a-z]{2,}`)
+	obfuscatedEmailAddress = regexp.MustCompile(`(?i)[a-z0-9._%+-]+\s*[\[(]\s*at\s*[\])]\s*[a-z0-9.-]+\s*[\[(]\s*dot\s*[\])]\s*[a-z]{2,}`)
+)
+
+func (a *Analyzer) findEmailAddresses() {
+	addresses := map[string]bool{}
+	a.document.Find("a[href^='mailto:']").Each(func(_ int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+		address := strings.SplitN(strings.TrimPrefix(href, "mailto:"), "?", 2)[0]
+		if address != "" {
+			addresses[strings.ToLower(address)] = true
+		}
+	})
+
+	text := a.document.Find("body").Text()
+	for _, address := range emailAddress.FindAllString(text, -1) {
+		addresses[strings.ToLower(address)] = true
+	}
+	obfuscated := len(obfuscatedEmailAddress.FindAllString(text, -1))
+
+	a.success(fmt.Sprintf("email addresses : %d (obfuscated: %d)", len(addresses), obfuscated))
+}
+
+func (a *Analyzer) findDOMDepth() {
+	a.success(fmt.Sprintf("max DOM depth : %d", depth(a.document.Selection)))
+}
+
+// depth returns the nesting depth of the deepest element below s.
+func depth(s *goquery.Selection) int {
+	var max int
+	s.Children().Each(func(_ int, child *goquery.Selection) {
+		if d := depth(child) + 1; d > max {
+			max = d
+		}
+	})
+	return max
+}
+
+func (a *Analyzer) findDuplicateIDs() {
+	ids := map[string]int{}
+	a.document.Find("[id]").Each(func(_ int, s *goquery.Selection) {
+		ids[s.AttrOr("id", "")]++
+	})
+
+	duplicates := map[string]int{}
+	for id, count := range ids {
+		if count > 1 {
+			duplicates[id] = count
+		}
+	}
+
+	if len(duplicates) == 0 {
+		a.success("duplicate ids : none")
+		return
+	}
+	a.success(fmt.Sprintf("duplicate ids : %s", html.EscapeString(formatCounts(duplicates, 0))))
+}
+
+func (a *Analyzer) findTables() {
+	tables := a.document.Find("table")
+	if tables.Length() == 0 {
+		a.success("tables : none")
+		return
+	}
+
+	tables.Each(func(i int, s *goquery.Selection) {
+		hasCaption := s.Find("caption").Length() > 0
+		hasHeaders := s.Find("th").Length() > 0
+		hasScope := s.Find("th[scope]").Length() > 0
+
+		summary := fmt.Sprintf("table %d : caption %t, headers %t, scope %t", i+1, hasCaption, hasHeaders, hasScope)
+		rows := s.Find("tr")
+		if !hasHeaders && rows.Length() > 1 && rows.First().Children().Length() > 1 {
+			summary += " (data table without headers)"
+		}
+		a.success(summary)
+	})
+}
+
+func (a *Analyzer) findHTTPSUpgrade() {
+	requestURL, err := url.Parse(a.requestURL)
+	if err != nil {
+		a.failure("findHTTPSUpgrade", fmt.Sprintf("https upgrade : %s", html.EscapeString(err.Error())))
+		return
+	}
+	if requestURL.Scheme == "https" {
+		a.success("https upgrade : page served over https")
+		return
+	}
+
+	// the preflight already followed the redirects of the page.
+	if len(a.redirects) > 0 && strings.HasPrefix(a.redirects[len(a.redirects)-1], "https://") {
+		a.success("https upgrade : http redirects to https")
+		return
+	}
+
+	httpsURL := *requestURL
+	httpsURL.Scheme = "https"
+	response, err := a.request(newHeadClient(), http.MethodGet, httpsURL.String())
+	if err != nil {
+		a.success("https upgrade : https not available")
+		return
+	}
+	response.Body.Close()
+	a.success("https upgrade : https available but http does not redirect")
+}
+
+func (a *Analyzer) findViewport() {
+	content, ok := a.document.Find("meta[name='viewport']").First().Attr("content")
+	if !ok {
+		a.success("viewport : not found")
+		return
+	}
+	a.success(fmt.Sprintf("viewport : %s", html.EscapeString(content)))
+
+	for _, property := range strings.FieldsFunc(content, func(r rune) bool { return r == ',' || r == ';' }) {
+		parts := strings.SplitN(property, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(parts[0]))
+		value := strings.ToLower(strings.TrimSpace(parts[1]))
+
+		switch key {
+		case "user-scalable":
+			if value == "no" || value == "0" {
+				a.warning(fmt.Sprintf("viewport prevents zooming : %s=%s", key, html.EscapeString(value)))
+			}
+		case "maximum-scale":
+			if scale, err := strconv.ParseFloat(value, 64); err == nil && scale <= 1 {
+				a.warning(fmt.Sprintf("viewport prevents zooming : %s=%s", key, html.EscapeString(value)))
+			}
+		}
+	}
+}
+
+func (a *Analyzer) findInlineEventHandlers() {
+	var handlers int
+	a.document.Find("*").Each(func(_ int, s *goquery.Selection) {
+		for _, attr := range s.Nodes[0].Attr {
+			if strings.HasPrefix(strings.ToLower(attr.Key), "on") {
+				handlers++
+			}
+		}
+	})
+	a.success(fmt.Sprintf("inline event handlers : %d", handlers))
+}
+
+// findTiming reports the timings of the preflight request. Clients share one transport,
+// so the preflight may reuse a pooled connection from an earlier analysis of the same
+// host, in which case dns, connect and tls are zero.
+func (a *Analyzer) findTiming() {
+	if a.timing == nil {
+		return
+	}
+	a.timing.mutex.Lock()
+	defer a.timing.mutex.Unlock()
+
+	a.success(fmt.Sprintf("time to first byte : %s", a.timing.firstByte.Round(time.Millisecond)))
+	a.success(fmt.Sprintf("dns : %s, connect : %s, tls : %s",
+		a.timing.dns.Round(time.Millisecond),
+		a.timing.connect.Round(time.Millisecond),
+		a.timing.tls.Round(time.Millisecond)))
+	a.success(fmt.Sprintf("connection reused : %t", a.timing.reusedConn))
+}
+
+// findCompression requests the page advertising gzip and brotli, with the credentials
+// of the preflight, and reports the Content-Encoding the server answers with. It doesn't
+// use the preflight response, which the transport decompresses transparently and which
+// couldn't be read if it were brotli encoded.
+func (a *Analyzer) findCompression() {
+	request, err := a.newRequest(http.MethodGet, a.requestURL)
+	if err != nil {
+		a.failure("findCompression", fmt.Sprintf("compression : %s", html.EscapeString(err.Error())))
+		return
+	}
+	request.Header.Set("Accept-Encoding", "gzip, br")
+
+	client := NewHTTPClient()
+	client.Timeout = 10 * time.Second
+	response, err := client.Do(request)
+	if err != nil {
+		a.failure("findCompression", fmt.Sprintf("compression : %s", html.EscapeString(err.Error())))
+		return
+	}
+	response.Body.Close()
+
+	encoding := strings.ToLower(strings.TrimSpace(response.Header.Get("Content-Encoding")))
+	if encoding == "" || encoding == "identity" {
+		a.warning("compression : none")
+		return
+	}
+	a.success(fmt.Sprintf("compression : %s", html.EscapeString(encoding)))
+}
+
+var dataURI = regexp.MustCompile(`(?i)data:([a-z]+/[a-z0-9.+-]+)?((?:;[a-z0-9=.+-]+)*),([^"'\s)]*)`)
+
+// findDataURIs counts resources inlined as data: URIs in attributes and CSS,
+// estimating their decoded size.
+func (a *Analyzer) findDataURIs() {
+	var count int
+	var total int64
+	for _, match := range dataURI.FindAllStringSubmatch(a.rawHTML, -1) {
+		count++
+		payload := match[3]
+		if strings.HasSuffix(strings.ToLower(match[2]), ";base64") {
+			payload = strings.TrimRight(payload, "=")
+			total += int64(len(payload)) * 3 / 4
+		} else if unescaped, err := url.PathUnescape(payload); err == nil {
+			total += int64(len(unescaped))
+		} else {
+			total += int64(len(payload))
+		}
+	}
+
+	if count == 0 {
+		a.success("data URIs : none")
+		return
+	}
+	a.success(fmt.Sprintf("data URIs : %d (total %s)", count, formatBytes(total)))
+}
+
+// findRenderDiff reports links and headings added by JavaScript and a changed title,
+// by comparing the rendered document with the html as served.
+func (a *Analyzer) findRenderDiff() {
+	if a.staticDocument == nil {
+		return
+	}
+
+	links := func(document *goquery.Document) map[string]bool {
+		found := map[string]bool{}
+		document.Find("a[href]").Each(func(_ int, s *goquery.Selection) {
+			if resolved, err := a.resolveURL(s.AttrOr("href", "")); err == nil {
+				found[resolved.String()] = true
+			}
+		})
+		return found
+	}
+	headings := func(document *goquery.Document) map[string]int {
+		found := map[string]int{}
+		document.Find("h1, h2, h3, h4, h5, h6").Each(func(_ int, s *goquery.Selection) {
+			found[goquery.NodeName(s)+":"+visibleText(s)]++
+		})
+		return found
+	}
+
+	var addedLinks int
+	staticLinks := links(a.staticDocument)
+	for link := range links(a.document) {
+		if !staticLinks[link] {
+			addedLinks++
+		}
+	}
+
+	var addedHeadings int
+	staticHeadings := headings(a.staticDocument)
+	for heading, count := range headings(a.document) {
+		if count > staticHeadings[heading] {
+			addedHeadings += count - staticHeadings[heading]
+		}
+	}
+
+	var changes []string
+	if addedLinks > 0 {
+		changes = append(changes, fmt.Sprintf("%d links added", addedLinks))
+	}
+	if addedHeadings > 0 {
+		changes = append(changes, fmt.Sprintf("%d headings added", addedHeadings))
+	}
+	staticTitle := strings.TrimSpace(a.staticDocument.Find("title").Text())
+	renderedTitle := strings.TrimSpace(a.document.Find("title").Text())
+	if staticTitle != renderedTitle {
+		changes = append(changes, fmt.Sprintf("title changed from %q to %q", staticTitle, renderedTitle))
+	}
+
+	if len(changes) == 0 {
+		a.success("javascript changes : none")
+		return
+	}
+	a.success(fmt.Sprintf("javascript changes : %s", html.EscapeString(strings.Join(changes, ", "))))
+}
+
+// emptyElementContent are elements which give an otherwise empty element content.
+const emptyElementContent = "img, svg, picture, video, audio, iframe, canvas, object, embed, input, select, textarea, button"
+
+// findEmptyElements counts headings, links, list items and paragraphs without any content,
+// which usually indicate markup bugs.
+func (a *Analyzer) findEmptyElements() {
+	empty := map[string]int{}
+	a.document.Find("h1, h2, h3, h4, h5, h6, a[href], li, p").Each(func(_ int, s *goquery.Selection) {
+		if visibleText(s) != "" || s.Find(emptyElementContent).Length() > 0 {
+			return
+		}
+		if _, ok := s.Attr("aria-label"); ok {
+			return
+		}
+		empty[goquery.NodeName(s)]++
+	})
+
+	if len(empty) == 0 {
+		a.success("empty elements : none")
+		return
+	}
+	a.success(fmt.Sprintf("empty elements : %s", formatCounts(empty, 0)))
+}
+
+func (a *Analyzer) findAccessKeys() {
+	keys := map[string]int{}
+	var count int
+	a.document.Find("[accesskey]").Each(func(_ int, s *goquery.Selection) {
+		// an accesskey may list several keys, the browser uses the first one it supports.
+		for _, key := range strings.Fields(strings.ToLower(s.AttrOr("accesskey", ""))) {
+			keys[key]++
+			count++
+		}
+	})
+	a.success(fmt.Sprintf("accesskeys : %d", count))
+
+	conflicts := map[string]int{}
+	for key, uses := range keys {
+		if uses > 1 {
+			conflicts[key] = uses
+		}
+	}
+	if len(conflicts) > 0 {
+		a.warning(fmt.Sprintf("accesskey conflicts : %s", html.EscapeString(formatCounts(conflicts, 0))))
+	}
+}
+
+// maxInlineScriptBytes is the total size of inline scripts above which they are
+// likely to block parsing noticeably.
+const maxInlineScriptBytes = 50 * 1024
+
+// findInlineScriptSize sums the size of inline scripts, as a rough heuristic for
+// main-thread blocking. Data blocks such as JSON-LD aren't executed and are skipped.
+func (a *Analyzer) findInlineScriptSize() {
+	var size int64
+	a.document.Find("script:not([src])").Each(func(_ int, s *goquery.Selection) {
+		scriptType := strings.ToLower(strings.TrimSpace(s.AttrOr("type", "")))
+		if scriptType != "" && scriptType != "module" && !strings.Contains(scriptType, "javascript") && !strings.Contains(scriptType, "ecmascript") {
+			return
+		}
+		size += int64(len(s.Text()))
+	})
+
+	if size > maxInlineScriptBytes {
+		a.warning(fmt.Sprintf("inline script size : %s, over %s", formatBytes(size), formatBytes(maxInlineScriptBytes)))
+		return
+	}
+	a.success(fmt.Sprintf("inline script size : %s", formatBytes(size)))
+}
+
+var sectioningElements = []string{"article", "section", "nav", "aside", "header", "footer", "main", "figure"}
+
+func (a *Analyzer) findSemanticStructure() {
+	counts := map[string]int{}
+	for _, element := range sectioningElements {
+		if count := a.document.Find(element).Length(); count > 0 {
+			counts[element] = count
+		}
+	}
+
+	if len(counts) == 0 {
+		if divs := a.document.Find("div").Length(); divs > 0 {
+			a.warning(fmt.Sprintf("semantic elements : none, %d divs", divs))
+			return
+		}
+		a.success("semantic elements : none")
+		return
+	}
+	a.success(fmt.Sprintf("semantic elements : %s", formatCounts(counts, 0)))
+}
+
+// findTrackingPixels looks for images of at most 1x1 pixels on external hosts,
+// which are likely tracking pixels, and reports the domains they report to.
+func (a *Analyzer) findTrackingPixels() {
+	tiny := func(s *goquery.Selection, attr string) bool {
+		value, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(s.AttrOr(attr, "")), "px"))
+		return err == nil && value <= 1
+	}
+
+	var pixels int
+	domains := map[string]bool{}
+	a.document.Find("img[src]").Each(func(_ int, s *goquery.Selection) {
+		if !tiny(s, "width") || !tiny(s, "height") {
+			return
+		}
+		source, err := a.resolveURL(s.AttrOr("src", ""))
+		if err != nil || source.Host == "" || a.isInternalHost(source.Hostname()) {
+			return
+		}
+
+		pixels++
+		domain, err := publicsuffix.EffectiveTLDPlusOne(strings.ToLower(source.Hostname()))
+		if err != nil {
+			domain = strings.ToLower(source.Hostname())
+		}
+		domains[domain] = true
+	})
+
+	if pixels == 0 {
+		a.success("tracking pixels : 0")
+		return
+	}
+	var names []string
+	for domain := range domains {
+		names = append(names, domain)
+	}
+	sort.Strings(names)
+	a.success(fmt.Sprintf("tracking pixels : %d (%s)", pixels, html.EscapeString(strings.Join(names, ", "))))
+}
+
+// findDisabledFormControls counts disabled and readonly form controls, including
+// controls disabled by a disabled fieldset.
+func (a *Analyzer) findDisabledFormControls() {
+	controls := a.document.Find("input:not([type='hidden']), select, textarea, button")
+	disabled := controls.FilterFunction(func(_ int, s *goquery.Selection) bool {
+		_, ok := s.Attr("disabled")
+		return ok || s.ParentsFiltered("fieldset[disabled]").Length() > 0
+	})
+	readonly := controls.Filter("input[readonly], textarea[readonly]")
+	a.success(fmt.Sprintf("disabled form controls : %d, readonly : %d", disabled.Length(), readonly.Length()))
+}
+
+// findSVGs counts inline svg elements against references to external svg files,
+// which are cached separately and don't add to the DOM.
+func (a *Analyzer) findSVGs() {
+	inline := a.document.Find("svg").FilterFunction(func(_ int, s *goquery.Selection) bool {
+		return s.ParentsFiltered("svg").Length() == 0
+	}).Length()
+
+	isSVG := func(ref string) bool {
+		parsedURL, err := url.Parse(strings.TrimSpace(ref))
+		return err == nil && strings.HasSuffix(strings.ToLower(parsedURL.Path), ".svg")
+	}
+	var external int
+	a.document.Find("img[src], object[data], embed[src], svg use, svg image").Each(func(_ int, s *goquery.Selection) {
+		for _, attr := range []string{"src", "data", "href", "xlink:href"} {
+			if ref, ok := s.Attr(attr); ok && isSVG(ref) {
+				external++
+				return
+			}
+		}
+	})
+	a.success(fmt.Sprintf("inline svgs : %d, external svgs : %d", inline, external))
+}
+
+// consentPlatforms maps script url fragments of consent management platforms to their names.
+var consentPlatforms = []struct{ fragment, name string }{
+	{"onetrust", "OneTrust"},
+	{"cookielaw.org", "OneTrust"},
+	{"cookiebot", "Cookiebot"},
+	{"didomi", "Didomi"},
+	{"usercentrics", "Usercentrics"},
+	{"quantcast", "Quantcast Choice"},
+	{"trustarc", "TrustArc"},
+	{"iubenda", "iubenda"},
+	{"osano", "Osano"},
+	{"termly", "Termly"},
+}
+
+var consentMarker = regexp.MustCompile(`(?i)cookie|consent|gdpr`)
+
+// findConsentBanner guesses whether the page has a cookie consent mechanism, from
+// the scripts of known consent platforms or elements named like a consent banner.
+func (a *Analyzer) findConsentBanner() {
+	platforms := map[string]bool{}
+	a.document.Find("script[src]").Each(func(_ int, s *goquery.Selection) {
+		src := strings.ToLower(s.AttrOr("src", ""))
+		for _, platform := range consentPlatforms {
+			if strings.Contains(src, platform.fragment) {
+				platforms[platform.name] = true
+			}
+		}
+	})
+	if len(platforms) > 0 {
+		var names []string
+		for name := range platforms {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		a.success(fmt.Sprintf("consent banner : %s", strings.Join(names, ", ")))
+		return
+	}
+
+	banner := a.document.Find("[id], [class]").FilterFunction(func(_ int, s *goquery.Selection) bool {
+		return consentMarker.MatchString(s.AttrOr("id", "") + " " + s.AttrOr("class", ""))
+	})
+	if banner.Length() > 0 {
+		a.success("consent banner : likely present")
+		return
+	}
+	a.success("consent banner : not found")
+}
+
+// autocompleteFields matches the name or id of inputs for personal data browsers can fill in.
+var autocompleteFields = regexp.MustCompile(`(?i)e-?mail|user-?name|(first|last|full|given|family)[_-]?name|^name$|phone|address|street|city|zip|postal|country`)
+
+// findInputAutocomplete reports inputs for personal data without an autocomplete
+// attribute, and password fields with autocomplete="off", which hinders password managers.
+func (a *Analyzer) findInputAutocomplete() {
+	var missing, passwordsOff int
+	a.document.Find("input").Each(func(_ int, s *goquery.Selection) {
+		inputType := strings.ToLower(strings.TrimSpace(s.AttrOr("type", "")))
+		if inputType == "" {
+			inputType = "text"
+		}
+		autocomplete, hasAutocomplete := s.Attr("autocomplete")
+		if inputType == "password" {
+			if strings.EqualFold(strings.TrimSpace(autocomplete), "off") {
+				passwordsOff++
+			}
+			return
+		}
+		if hasAutocomplete {
+			return
+		}
+		if inputType == "email" || inputType == "tel" ||
+			(inputType == "text" && (autocompleteFields.MatchString(s.AttrOr("name", "")) || autocompleteFields.MatchString(s.AttrOr("id", "")))) {
+			missing++
+		}
+	})
+
+	if missing == 0 && passwordsOff == 0 {
+		a.success("autocomplete issues : none")
+		return
+	}
+	a.warning(fmt.Sprintf("autocomplete issues : %d inputs missing autocomplete, %d password fields with autocomplete off", missing, passwordsOff))
+}
+
+// request sends a request built by newRequest.
+func (a *Analyzer) request(client *http.Client, method, rawURL string) (*http.Response, error) {
+	request, err := a.newRequest(method, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(request)
+}
+
+// newRequest returns a request with the context of the analysis, so it's cancelled
+// when a fail-fast analysis stops, and with the referer and, to the host of the
+// page, the credentials of the analyzed request.
+func (a *Analyzer) newRequest(method, rawURL string) (*http.Request, error) {
+	if err := checkDomain(rawURL); err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequestWithContext(a.ctx, method, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if a.origin.Referer != "" {
+		request.Header.Set("Referer", a.origin.Referer)
+	}
+	// credentials are only for the analyzed site, never for third party hosts.
+	if page, err := url.Parse(a.requestURL); err == nil && strings.EqualFold(request.URL.Host, page.Host) {
+		a.origin.authorize(request)
+	}
+	return request, nil
+}
+
+// findLongClassLists counts elements with more classes than ANALYZER_MAX_CLASSES,
+// which is common with utility frameworks but hard to maintain.
+func (a *Analyzer) findLongClassLists() {
+	limit := getEnvInt("ANALYZER_MAX_CLASSES", 20)
+	elements := a.document.Find("[class]").FilterFunction(func(_ int, s *goquery.Selection) bool {
+		return len(strings.Fields(s.AttrOr("class", ""))) > limit
+	})
+	a.success(fmt.Sprintf("elements with >%d classes : %d", limit, elements.Length()))
+}
+
+var feedTypes = map[string]bool{"application/rss+xml": true, "application/atom+xml": true}
+
+func (a *Analyzer) findRSSFeeds() {
+	var feeds []string
+	a.document.Find("link[rel][href][type]").Each(func(_ int, s *goquery.Selection) {
+		alternate := false
+		for _, rel := range strings.Fields(strings.ToLower(s.AttrOr("rel", ""))) {
+			alternate = alternate || rel == "alternate"
+		}
+		if !alternate || !feedTypes[strings.ToLower(strings.TrimSpace(s.AttrOr("type", "")))] {
+			return
+		}
+
+		feed := s.AttrOr("href", "")
+		if resolved, err := a.resolveURL(feed); err == nil {
+			feed = resolved.String()
+		}
+		feeds = append(feeds, feed)
+	})
+
+	if len(feeds) == 0 {
+		a.success("feeds : none")
+		return
+	}
+	a.success(fmt.Sprintf("feeds : %s", html.EscapeString(strings.Join(feeds, ", "))))
+}
+
+var doNotTrackCheck = regexp.MustCompile(`\b(navigator|window)\.(doNotTrack|msDoNotTrack)\b`)
+
+// findDoNotTrack guesses whether the page honors Do Not Track, from inline scripts
+// reading navigator.doNotTrack, as tracking loaders typically do before loading.
+func (a *Analyzer) findDoNotTrack() {
+	var honored bool
+	a.document.Find("script:not([src])").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		honored = doNotTrackCheck.MatchString(s.Text())
+		return !honored
+	})
+	a.success(fmt.Sprintf("do not track checked : %t", honored))
+}
+
+// languageStopwords are frequent words of languages, used to guess the language of text.
+var languageStopwords = wordSets(map[string]string{
+	"en": "the and of to is in that it for with was on are this be as by not you",
+	"de": "der die und das ist nicht zu den mit sich des auf für ein eine dem wir ich auch",
+	"fr": "le la les et des est une un du que pour dans qui pas sur au avec ce sont",
+	"es": "el la los las y que es en del por una un para con no se al lo como",
+	"it": "il di che la è e per una non sono con del della gli le questo anche si",
+	"nl": "de het een en van is dat niet op te zijn voor met die ook maar wij er",
+	"pt": "o os a as e que do da não em um uma para com se por mais são ao",
+})
+
+// wordSets splits space separated words into sets.
+func wordSets(words map[string]string) map[string]map[string]bool {
+	sets := map[string]map[string]bool{}
+	for key, list := range words {
+		sets[key] = map[string]bool{}
+		for _, word := range strings.Fields(list) {
+			sets[key][word] = true
+		}
+	}
+	return sets
+}
+
+// minLanguageWords is the number of words below which the language of text isn't guessed.
+const minLanguageWords = 12
+
+// guessLanguage returns the language whose stopwords make up most of text, or an
+// empty string when text is too short or no language clearly stands out.
+func guessLanguage(text string) string {
+	words := strings.Fields(strings.ToLower(text))
+	if len(words) < minLanguageWords {
+		return ""
+	}
+
+	hits := map[string]int{}
+	for _, word := range words {
+		word = strings.Trim(word, ".,;:!?\"'()«»„“”")
+		for language, stopwords := range languageStopwords {
+			if stopwords[word] {
+				hits[language]++
+			}
+		}
+	}
+
+	var best, second int
+	var language string
+	for candidate, count := range hits {
+		switch {
+		case count > best:
+			best, second, language = count, best, candidate
+		case count > second:
+			second = count
+		}
+	}
+	// require a share of stopwords typical for running text, and a clear winner.
+	if best*5 < len(words) || best < 2*second {
+		return ""
+	}
+	return language
+}
+
+// findMissingLangOnContent looks for text blocks which seem to be in another language
+// than the lang attribute in effect for them, which screen readers would mispronounce.
+func (a *Analyzer) findMissingLangOnContent() {
+	untagged := map[string]int{}
+	a.document.Find("p, li, blockquote, td, dd, figcaption").Each(func(_ int, s *goquery.Selection) {
+		declared := strings.ToLower(strings.TrimSpace(s.Closest("[lang]").AttrOr("lang", "")))
+		declared = strings.SplitN(declared, "-", 2)[0]
+		if _, ok := languageStopwords[declared]; !ok {
+			return
+		}
+		if language := guessLanguage(visibleText(s)); language != "" && language != declared {
+			untagged[language]++
+		}
+	})
+
+	if len(untagged) == 0 {
+		a.success("possible untagged foreign-language content : none")
+		return
+	}
+	a.warning(fmt.Sprintf("possible untagged foreign-language content : %s", formatCounts(untagged, 0)))
+}
+
+var viewportUnit = regexp.MustCompile(`(?i)\d(\.\d+)?(d|s|l)?(vh|vw|vmin|vmax)\b`)
+
+// findViewportUnits counts inline styles using viewport units, which hint at the
+// responsive approach of a page and at mobile quirks such as 100vh overflowing.
+func (a *Analyzer) findViewportUnits() {
+	styles := a.document.Find("[style]").FilterFunction(func(_ int, s *goquery.Selection) bool {
+		return viewportUnit.MatchString(s.AttrOr("style", ""))
+	})
+	a.success(fmt.Sprintf("viewport-unit inline styles : %d", styles.Length()))
+}
+
+// newHeadClient returns an HTTP client for the HEAD requests checks issue for
+// linked resources, bounded by ANALYZER_HEAD_TIMEOUT.
+func newHeadClient() *http.Client {
+	client := NewHTTPClient()
+	client.Timeout = getEnvDuration("ANALYZER_HEAD_TIMEOUT", 10*time.Second)
+	return client
+}
+
+// forEachConcurrently calls f for each of items, running at most limit calls
+// at a time, and waits for all of them. No more calls start once ctx is done.
+// A panic in a call is raised again in the caller once all calls finished, so
+// that it fails the check which called forEachConcurrently instead of crashing.
+func forEachConcurrently(ctx context.Context, items []string, limit int, f func(item string)) {
+	if limit < 1 {
+		limit = 1
+	}
+
+	semaphore := make(chan struct{}, limit)
+	var waitGroup sync.WaitGroup
+	var mutex sync.Mutex
+	var panicked interface{}
+	for _, item := range items {
+		semaphore <- struct{}{}
+		if ctx.Err() != nil {
+			break
+		}
+		waitGroup.Add(1)
+		go func(item string) {
+			defer waitGroup.Done()
+			defer func() { <-semaphore }()
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("call for %s panicked: %v\n%s", item, r, debug.Stack())
+					mutex.Lock()
+					defer mutex.Unlock()
+					if panicked == nil {
+						panicked = r
+					}
+				}
+			}()
+			f(item)
+		}(item)
+	}
+	waitGroup.Wait()
+
+	if panicked != nil {
+		panic(panicked)
+	}
+}
+
+// formatBytes formats a byte count in B, KB or MB.
+func formatBytes(bytes int64) string {
+	switch {
+	case bytes >= 1024*1024:
+		return fmt.Sprintf("%.1f MB", float64(bytes)/(1024*1024))
+	case bytes >= 1024:
+		return fmt.Sprintf("%.1f KB", float64(bytes)/1024)
+	}
+	return fmt.Sprintf("%d B", bytes)
+}
+
+// findImageSizes sums the Content-Length of every image, as reported by HEAD requests.
+func (a *Analyzer) findImageSizes() {
+	seen := map[string]bool{}
+	var images []string
+	a.document.Find("img[src]").Each(func(_ int, s *goquery.Selection) {
+		resolved, err := a.resolveURL(s.AttrOr("src", ""))
+		if err != nil || (resolved.Scheme != "http" && resolved.Scheme != "https") {
+			return
+		}
+		if image := resolved.String(); !seen[image] {
+			seen[image] = true
+			images = append(images, image)
+		}
+	})
+	if len(images) == 0 {
+		a.success("total image weight : 0 B")
+		return
+	}
+
+	client := newHeadClient()
+	var mutex sync.Mutex
+	var total, largestSize int64
+	var largest string
+	var unknown int
+	forEachConcurrently(a.ctx, images, getEnvInt("ANALYZER_HEAD_CONCURRENCY", 8), func(image string) {
+		var size int64 = -1
+		if response, err := a.request(client, http.MethodHead, image); err == nil {
+			response.Body.Close()
+			if response.StatusCode < http.StatusBadRequest {
+				size = response.ContentLength
+			}
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		if size < 0 {
+			unknown++
+			return
+		}
+		total += size
+		if size > largestSize {
+			largestSize = size
+			largest = image
+		}
+	})
+
+	message := fmt.Sprintf("total image weight : %s", formatBytes(total))
+	if largest != "" {
+		message += fmt.Sprintf(" (largest: %s, %s)", html.EscapeString(largest), formatBytes(largestSize))
+	}
+	if unknown > 0 {
+		message += fmt.Sprintf(", unknown size: %d", unknown)
+	}
+	a.success(message)
+}
+
+// faviconURL returns the icon the page declares, or else /favicon.ico, which browsers
+// request by default.
+func (a *Analyzer) faviconURL() (*url.URL, error) {
+	href := "/favicon.ico"
+	a.document.Find("link[rel][href]").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		for _, rel := range strings.Fields(strings.ToLower(s.AttrOr("rel", ""))) {
+			if rel == "icon" {
+				href = s.AttrOr("href", "")
+				return false
+			}
+		}
+		return true
+	})
+	return a.resolveURL(href)
+}
+
+// findFavicon checks that the favicon is reachable, falling back to GET for
+// servers which don't support HEAD.
+func (a *Analyzer) findFavicon() {
+	favicon, err := a.faviconURL()
+	if err != nil {
+		a.failure("findFavicon", fmt.Sprintf("favicon : %s", html.EscapeString(err.Error())))
+		return
+	}
+	if favicon.Scheme == "data" {
+		a.success("favicon : inline data URI")
+		return
+	}
+
+	client := newHeadClient()
+	response, err := a.request(client, http.MethodHead, favicon.String())
+	if err == nil && response.StatusCode == http.StatusMethodNotAllowed {
+		response.Body.Close()
+		response, err = a.request(client, http.MethodGet, favicon.String())
+	}
+	if err != nil {
+		a.warning(fmt.Sprintf("favicon : %s unreachable", html.EscapeString(favicon.String())))
+		return
+	}
+	response.Body.Close()
+
+	message := fmt.Sprintf("favicon : %s (status %d, %s)", favicon, response.StatusCode, response.Header.Get("Content-Type"))
+	if response.StatusCode >= http.StatusBadRequest {
+		a.warning(html.EscapeString(message))
+		return
+	}
+	a.success(html.EscapeString(message))
+}
+
+// robotsDisallowed returns the path prefixes robots disallows for all user agents.
+func robotsDisallowed(robots string) []string {
+	var disallowed []string
+	var applies, inRules bool
+	for _, line := range strings.Split(robots, "\n") {
+		line = strings.TrimSpace(strings.SplitN(line, "#", 2)[0])
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		field, value := strings.ToLower(strings.TrimSpace(parts[0])), strings.TrimSpace(parts[1])
+
+		switch field {
+		case "user-agent":
+			// consecutive user-agent lines share the rules that follow them.
+			if inRules {
+				applies, inRules = false, false
+			}
+			applies = applies || value == "*"
+		case "disallow":
+			inRules = true
+			if applies && value != "" {
+				disallowed = append(disallowed, value)
+			}
+		case "allow":
+			inRules = true
+		}
+	}
+	return disallowed
+}
+
+// crawlLinks fetches the internal links of the page, up to ANALYZER_CRAWL_MAX_PAGES
+// of them and skipping those robots.txt disallows, and reports the broken ones.
+func (a *Analyzer) crawlLinks() {
+	robots, err := a.fetchRobotsTxt()
+	if err != nil {
+		a.warning(fmt.Sprintf("crawl : %s", html.EscapeString(err.Error())))
+	}
+	disallowed := robotsDisallowed(robots)
+	allowed := func(link *url.URL) bool {
+		for _, prefix := range disallowed {
+			if strings.HasPrefix(link.EscapedPath(), prefix) {
+				return false
+			}
+		}
+		return true
+	}
+
+	limit := getEnvInt("ANALYZER_CRAWL_MAX_PAGES", 20)
+	seen := map[string]bool{a.requestURL: true}
+	var pages []string
+	var skipped int
+	a.document.Find("a[href]").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		link, err := a.resolveURL(s.AttrOr("href", ""))
+		if err != nil || (link.Scheme != "http" && link.Scheme != "https") || !a.isInternalHost(link.Hostname()) {
+			return true
+		}
+		link.Fragment = ""
+		if seen[link.String()] {
+			return true
+		}
+		seen[link.String()] = true
+
+		if !allowed(link) {
+			skipped++
+			return true
+		}
+		pages = append(pages, link.String())
+		return len(pages) < limit
+	})
+
+	client := NewHTTPClient()
+	client.Timeout = getEnvDuration("ANALYZER_CRAWL_TIMEOUT", 10*time.Second)
+	var mutex sync.Mutex
+	var broken []string
+	forEachConcurrently(a.ctx, pages, getEnvInt("ANALYZER_CRAWL_CONCURRENCY", 4), func(page string) {
+		response, err := a.request(client, http.MethodGet, page)
+		if err == nil {
+			response.Body.Close()
+			if response.StatusCode < http.StatusBadRequest {
+				return
+			}
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		broken = append(broken, page)
+	})
+
+	a.success(fmt.Sprintf("pages crawled : %d (disallowed by robots.txt: %d)", len(pages), skipped))
+	if len(broken) == 0 {
+		a.success("broken internal links : 0")
+		return
+	}
+	sort.Strings(broken)
+	a.warning(fmt.Sprintf("broken internal links : %d (%s)", len(broken), html.EscapeString(strings.Join(broken, ", "))))
+}
+
+func (a *Analyzer) findResponsiveImages() {
+	images := a.document.Find("img")
+	responsive := images.FilterFunction(func(_ int, s *goquery.Selection) bool {
+		_, hasSrcset := s.Attr("srcset")
+		return hasSrcset || s.ParentFiltered("picture").Length() > 0
+	}).Length()
+	pictures := a.document.Find("picture").Length()
+
+	a.success(fmt.Sprintf("responsive images : %d of %d (picture elements: %d)", responsive, images.Length(), pictures))
+}
+
+var (
+	imageFormatAliases = map[string]string{"jpeg": "jpg", "svg+xml": "svg"}
+	legacyImageFormats = map[string]bool{"jpg": true, "png": true, "gif": true, "bmp": true}
+	modernImageFormats = map[string]bool{"webp": true, "avif": true}
+)
+
+// imageFormat returns the format of an image from its data URI media type or
+// file extension, or an empty string when it can't be told.
+func imageFormat(src string) string {
+	var format string
+	if strings.HasPrefix(src, "data:image/") {
+		format = strings.SplitN(strings.TrimPrefix(src, "data:image/"), ";", 2)[0]
+		format = strings.SplitN(format, ",", 2)[0]
+	} else if parsed, err := url.Parse(src); err == nil {
+		format = strings.TrimPrefix(path.Ext(parsed.Path), ".")
+	}
+
+	format = strings.ToLower(format)
+	if alias, ok := imageFormatAliases[format]; ok {
+		format = alias
+	}
+	return format
+}
+
+func (a *Analyzer) findImageFormats() {
+	formats := map[string]int{}
+	a.document.Find("img[src]").Each(func(_ int, s *goquery.Selection) {
+		if format := imageFormat(s.AttrOr("src", "")); format != "" {
+			formats[format]++
+		}
+	})
+	a.document.Find("picture source[type]").Each(func(_ int, s *goquery.Selection) {
+		format := strings.TrimPrefix(strings.ToLower(s.AttrOr("type", "")), "image/")
+		if alias, ok := imageFormatAliases[format]; ok {
+			format = alias
+		}
+		formats[format]++
+	})
+
+	if len(formats) == 0 {
+		a.success("image formats : none")
+		return
+	}
+	a.success(fmt.Sprintf("image formats : %s", html.EscapeString(formatCounts(formats, 0))))
+
+	var legacy, modern int
+	for format, count := range formats {
+		if legacyImageFormats[format] {
+			legacy += count
+		} else if modernImageFormats[format] {
+			modern += count
+		}
+	}
+	if legacy >= 3 && legacy > modern {
+		a.warning(fmt.Sprintf("legacy image formats : %d images could use webp or avif", legacy))
+	}
+}
+
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+func (a *Analyzer) findNoscript() {
+	noscripts := a.document.Find("noscript")
+
+	// noscript content is parsed as raw text when scripting is enabled.
+	var meaningful bool
+	noscripts.Each(func(_ int, s *goquery.Selection) {
+		if strings.TrimSpace(htmlTag.ReplaceAllString(s.Text(), "")) != "" {
+			meaningful = true
+		}
+	})
+
+	a.success(fmt.Sprintf("noscript blocks : %d (meaningful fallback: %t)", noscripts.Length(), meaningful))
+	if !meaningful && a.document.Find("script").Length() > 0 {
+		a.warning("noscript fallback : none although the page uses javascript")
+	}
+}
+
+func (a *Analyzer) findAbsoluteInternalLinks() {
+	page, err := url.Parse(a.requestURL)
+	if err != nil {
+		a.failure("findAbsoluteInternalLinks", fmt.Sprintf("absolute internal links : %s", html.EscapeString(err.Error())))
+		return
+	}
+
+	absolute := map[string]bool{}
+	a.document.Find("a[href]").Each(func(_ int, s *goquery.Selection) {
+		href := strings.TrimSpace(s.AttrOr("href", ""))
+		parsed, err := url.Parse(href)
+		if err != nil || parsed.Host == "" {
+			return
+		}
+		if strings.EqualFold(parsed.Hostname(), page.Hostname()) {
+			absolute[href] = true
+		}
+	})
+	a.success(fmt.Sprintf("absolute internal links : %d", len(absolute)))
+}
+
+func (a *Analyzer) findPaginationLinks() {
+	find := func(rels ...string) string {
+		var target string
+		a.document.Find("link[rel][href], a[rel][href]").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+			for _, rel := range strings.Fields(strings.ToLower(s.AttrOr("rel", ""))) {
+				for _, want := range rels {
+					if rel != want {
+						continue
+					}
+					target = s.AttrOr("href", "")
+					if resolved, err := a.resolveURL(target); err == nil {
+						target = resolved.String()
+					}
+					return false
+				}
+			}
+			return true
+		})
+		return target
+	}
+
+	next := find("next")
+	prev := find("prev", "previous")
+	if next == "" && prev == "" {
+		a.success("pagination : none")
+		return
+	}
+
+	var relations []string
+	if next != "" {
+		relations = append(relations, "next="+next)
+	}
+	if prev != "" {
+		relations = append(relations, "prev="+prev)
+	}
+	a.success(fmt.Sprintf("pagination : %s", html.EscapeString(strings.Join(relations, ", "))))
+}
+
+// dimension returns the pixel value of a width or height attribute, or zero.
+func dimension(s *goquery.Selection, attr string) int {
+	value, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(s.AttrOr(attr, "")), "px"))
+	if err != nil || value < 0 {
+		return 0
+	}
+	return value
+}
+
+// findLargestContentfulElement guesses the Largest Contentful Paint element as the image
+// with the biggest declared size or, without sized images, the longest block of text.
+func (a *Analyzer) findLargestContentfulElement() {
+	var largestImage string
+	var largestArea int
+	a.document.Find("img[src]").Each(func(_ int, s *goquery.Selection) {
+		if area := dimension(s, "width") * dimension(s, "height"); area > largestArea {
+			largestArea = area
+			largestImage = s.AttrOr("src", "")
+		}
+	})
+	if largestImage != "" {
+		a.success(fmt.Sprintf("likely LCP element : img[src=%s]", html.EscapeString(largestImage)))
+		return
+	}
+
+	var longestBlock string
+	var longestText int
+	a.document.Find("p, h1, h2, h3, h4, h5, h6, li, blockquote").Each(func(_ int, s *goquery.Selection) {
+		if length := len(strings.TrimSpace(s.Text())); length > longestText {
+			longestText = length
+			longestBlock = goquery.NodeName(s)
+		}
+	})
+	if longestBlock == "" {
+		a.success("likely LCP element : none")
+		return
+	}
+	a.success(fmt.Sprintf("likely LCP element : %s (%d characters)", longestBlock, longestText))
+}
+
+// visibleText returns the text of s without scripts and styles, with whitespace collapsed.
+func visibleText(s *goquery.Selection) string {
+	clone := s.Clone()
+	clone.Find("script, style, noscript, template").Remove()
+	return strings.Join(strings.Fields(clone.Text()), " ")
+}
+
+func (a *Analyzer) findTextToHTMLRatio() {
+	if len(a.rawHTML) == 0 {
+		a.success("text-to-html ratio : 0%")
+		return
+	}
+	text := visibleText(a.document.Find("body"))
+	a.success(fmt.Sprintf("text-to-html ratio : %d%%", len(text)*100/len(a.rawHTML)))
+}
+
+// maxCharsetOffset is the number of bytes within which browsers look for a charset declaration.
+const maxCharsetOffset = 1024
+
+var metaCharset = regexp.MustCompile(`(?i)<meta[^>]+charset\s*=`)
+
+// findMetaCharsetPosition measures the offset of the charset declaration in the bytes
+// as served, since Chrome's serialization of the rendered page moves it.
+func (a *Analyzer) findMetaCharsetPosition() {
+	served := a.body
+	if served == nil {
+		served = []byte(a.rawHTML)
+	}
+	location := metaCharset.FindIndex(served)
+	if location == nil {
+		a.success("charset declaration : not found")
+		return
+	}
+
+	if location[0] >= maxCharsetOffset {
+		a.warning(fmt.Sprintf("charset declared too late (byte %d)", location[0]))
+		return
+	}
+	a.success(fmt.Sprintf("charset declaration : byte %d", location[0]))
+}
+
+// platforms lists signatures of common CMS and site builders found in page source.
+var platforms = []struct {
+	name    string
+	markers []string
+}{
+	{"WordPress", []string{"/wp-content/", "/wp-includes/"}},
+	{"Shopify", []string{"cdn.shopify.com"}},
+	{"Wix", []string{"static.wixstatic.com", "static.parastorage.com"}},
+	{"Squarespace", []string{"static1.squarespace.com", "squarespace-cdn.com"}},
+	{"Drupal", []string{"/sites/default/files/", "drupal-settings-json"}},
+	{"Joomla", []string{"/media/jui/", "/components/com_"}},
+}
+
+var generatorVersion = regexp.MustCompile(`\d+(\.\d+)*`)
+
+func (a *Analyzer) findPlatform() {
+	generator := a.document.Find("meta[name='generator']").AttrOr("content", "")
+	for _, platform := range platforms {
+		if strings.Contains(strings.ToLower(generator), strings.ToLower(platform.name)) {
+			name := platform.name
+			if version := generatorVersion.FindString(generator); version != "" {
+				name += " " + version
+			}
+			a.success(fmt.Sprintf("platform : %s", html.EscapeString(name)))
+			return
+		}
+	}
+
+	source := strings.ToLower(a.rawHTML)
+	for _, platform := range platforms {
+		for _, marker := range platform.markers {
+			if strings.Contains(source, marker) {
+				a.success(fmt.Sprintf("platform : %s", platform.name))
+				return
+			}
+		}
+	}
+	a.success("platform : unknown")
+}
+
+// mainContent returns the main content of the page, selected by the content selector
+// of the request or else the main or article element. ok is false if there is none.
+func (a *Analyzer) mainContent() (content *goquery.Selection, ok bool) {
+	selectors := []string{"main", "article"}
+	if a.contentSelector != "" {
+		selectors = []string{a.contentSelector}
+	}
+	for _, selector := range selectors {
+		if content = a.document.Find(selector); content.Length() > 0 {
+			return content, true
+		}
+	}
+	return nil, false
+}
+
+func (a *Analyzer) findWordCount() {
+	a.success(fmt.Sprintf("word count : %d", len(strings.Fields(visibleText(a.document.Find("body"))))))
+
+	content, ok := a.mainContent()
+	if !ok {
+		a.success("content word count : no main content found")
+		return
+	}
+	var words int
+	content.Each(func(_ int, s *goquery.Selection) {
+		words += len(strings.Fields(visibleText(s)))
+	})
+	a.success(fmt.Sprintf("content word count : %d", words))
+}
+
+func (a *Analyzer) findExternalFormActions() {
+	if _, err := url.Parse(a.requestURL); err != nil {
+		a.failure("findExternalFormActions", fmt.Sprintf("cross-origin form actions : %s", html.EscapeString(err.Error())))
+		return
+	}
+
+	var crossOrigin int
+	a.document.Find("form[action]").Each(func(_ int, s *goquery.Selection) {
+		action, err := a.resolveURL(s.AttrOr("action", ""))
+		if err != nil || action.Host == "" {
+			return
+		}
+		if !a.isInternalHost(action.Hostname()) {
+			crossOrigin++
+			a.warning(fmt.Sprintf("cross-origin form action : %s", html.EscapeString(action.String())))
+		}
+	})
+	if crossOrigin == 0 {
+		a.success("cross-origin form actions : 0")
+	}
+}
+
+func (a *Analyzer) findDataAttributes() {
+	attributes := map[string]int{}
+	var total int
+	a.document.Find("*").Each(func(_ int, s *goquery.Selection) {
+		for _, attr := range s.Nodes[0].Attr {
+			if strings.HasPrefix(strings.ToLower(attr.Key), "data-") {
+				attributes[strings.ToLower(attr.Key)]++
+				total++
+			}
+		}
+	})
+
+	if total == 0 {
+		a.success("data attributes : 0")
+		return
+	}
+	a.success(fmt.Sprintf("data attributes : %d (%s)", total, html.EscapeString(formatCounts(attributes, 10))))
+}
+
+var skipLinkTargets = map[string]bool{"main": true, "content": true, "main-content": true, "maincontent": true}
+
+// findSkipLink looks for a "skip to content" link among the first links of the page.
+func (a *Analyzer) findSkipLink() {
+	var found bool
+	a.document.Find("a[href]").EachWithBreak(func(i int, s *goquery.Selection) bool {
+		href := strings.TrimSpace(s.AttrOr("href", ""))
+		if strings.HasPrefix(href, "#") && len(href) > 1 {
+			text := strings.ToLower(s.Text())
+			found = strings.Contains(text, "skip") || skipLinkTargets[strings.ToLower(href[1:])]
+		}
+		return !found && i < 2
+	})
+	a.success(fmt.Sprintf("skip link : %t", found))
+}
+
+func (a *Analyzer) findResourceSummary() {
+	if _, err := url.Parse(a.requestURL); err != nil {
+		a.failure("findResourceSummary", fmt.Sprintf("resource summary : %s", html.EscapeString(err.Error())))
+		return
+	}
+
+	kinds := map[string]int{}
+	var total, thirdParty int
+	for _, resource := range a.subresources() {
+		kinds[resource.kind]++
+		total++
+		if resource.url.Host != "" && !a.isInternalHost(resource.url.Hostname()) {
+			thirdParty++
+		}
+	}
+
+	if total == 0 {
+		a.success("resource summary : none")
+		return
+	}
+	a.success(fmt.Sprintf("resource summary : %s, total %d, third party %d", formatCounts(kinds, 0), total, thirdParty))
+}
+
+// hasLinkMatching reports whether any link's text or href contains one of keywords,
+// ignoring case.
+func (a *Analyzer) hasLinkMatching(keywords ...string) bool {
+	var found bool
+	a.document.Find("a[href]").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		candidate := strings.ToLower(s.Text() + " " + s.AttrOr("href", ""))
+		for _, keyword := range keywords {
+			if strings.Contains(candidate, keyword) {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+func (a *Analyzer) findPrivacyPolicyLink() {
+	a.success(fmt.Sprintf("privacy policy link : %t", a.hasLinkMatching("privacy")))
+	a.success(fmt.Sprintf("terms link : %t", a.hasLinkMatching("terms", "conditions")))
+}
+
+func (a *Analyzer) findFormsWithoutAction() {
+	forms := a.document.Find("form").FilterFunction(func(_ int, s *goquery.Selection) bool {
+		return strings.TrimSpace(s.AttrOr("action", "")) == ""
+	})
+	a.success(fmt.Sprintf("forms without action : %d", forms.Length()))
+}
+
+// hasAccessibleName reports whether an image has a text alternative, or is marked
+// as decorative with an empty alt, role="presentation" or aria-hidden.
+func hasAccessibleName(s *goquery.Selection) bool {
+	if alt, ok := s.Attr("alt"); ok && (alt == "" || strings.TrimSpace(alt) != "") {
+		return true
+	}
+	for _, attr := range []string{"aria-label", "aria-labelledby"} {
+		if strings.TrimSpace(s.AttrOr(attr, "")) != "" {
+			return true
+		}
+	}
+	role := strings.ToLower(s.AttrOr("role", ""))
+	return role == "presentation" || role == "none" || strings.EqualFold(s.AttrOr("aria-hidden", ""), "true")
+}
+
+func (a *Analyzer) findInaccessibleImages() {
+	images := a.document.Find("img").FilterFunction(func(_ int, s *goquery.Selection) bool {
+		return !hasAccessibleName(s)
+	})
+	a.success(fmt.Sprintf("images without accessible name : %d", images.Length()))
+}
+
+var importantDeclaration = regexp.MustCompile(`(?i)!\s*important`)
+
+func (a *Analyzer) findInlineImportant() {
+	var declarations int
+	a.document.Find("[style]").Each(func(_ int, s *goquery.Selection) {
+		declarations += len(importantDeclaration.FindAllString(s.AttrOr("style", ""), -1))
+	})
+	a.success(fmt.Sprintf("inline !important declarations : %d", declarations))
+}
+
+func (a *Analyzer) findMetaThemeColor() {
+	var colors []string
+	a.document.Find("meta[name='theme-color'][content]").Each(func(_ int, s *goquery.Selection) {
+		color := strings.TrimSpace(s.AttrOr("content", ""))
+		if media := strings.TrimSpace(s.AttrOr("media", "")); media != "" {
+			color += fmt.Sprintf(" (%s)", media)
+		}
+		colors = append(colors, color)
+	})
+
+	if len(colors) == 0 {
+		a.success("theme color : not found")
+		return
+	}
+	a.success(fmt.Sprintf("theme color : %s", html.EscapeString(strings.Join(colors, ", "))))
+}
+
+// appMetadataNames are meta names used when a page is bookmarked or added to a home screen.
+var appMetadataNames = []string{
+	"application-name",
+	"apple-mobile-web-app-title",
+	"apple-mobile-web-app-capable",
+	"apple-mobile-web-app-status-bar-style",
+	"msapplication-tilecolor",
+	"msapplication-tileimage",
+}
+
+func (a *Analyzer) findAppMetadata() {
+	values := map[string]string{}
+	a.document.Find("meta[name][content]").Each(func(_ int, s *goquery.Selection) {
+		values[strings.ToLower(strings.TrimSpace(s.AttrOr("name", "")))] = strings.TrimSpace(s.AttrOr("content", ""))
+	})
+
+	var metadata []string
+	for _, name := range appMetadataNames {
+		if value, ok := values[name]; ok {
+			metadata = append(metadata, fmt.Sprintf("%s=%s", name, value))
+		}
+	}
+
+	if len(metadata) == 0 {
+		a.success("app metadata : not found")
+		return
+	}
+	a.success(fmt.Sprintf("app metadata : %s", html.EscapeString(strings.Join(metadata, ", "))))
+}
+
+func (a *Analyzer) findPWA() {
+	manifest, hasManifest := a.document.Find("link[rel='manifest'][href]").First().Attr("href")
+	if hasManifest {
+		if resolved, err := a.resolveURL(manifest); err == nil {
+			manifest = resolved.String()
+		}
+		a.success(fmt.Sprintf("web app manifest : %s", html.EscapeString(manifest)))
+	} else {
+		a.success("web app manifest : not found")
+	}
+
+	var serviceWorker bool
+	a.document.Find("script:not([src])").Each(func(_ int, s *goquery.Selection) {
+		if strings.Contains(s.Text(), "serviceWorker.register") {
+			serviceWorker = true
+		}
+	})
+	a.success(fmt.Sprintf("service worker registration : %t", serviceWorker))
+	a.success(fmt.Sprintf("pwa candidate : %t", hasManifest && serviceWorker))
+}
+
+func (a *Analyzer) findPositiveTabindex() {
+	elements := a.document.Find("[tabindex]").FilterFunction(func(_ int, s *goquery.Selection) bool {
+		tabindex, err := strconv.Atoi(strings.TrimSpace(s.AttrOr("tabindex", "")))
+		return err == nil && tabindex > 0
+	})
+	a.success(fmt.Sprintf("positive tabindex elements : %d", elements.Length()))
+}
+
+// minRenderedElements is the number of body elements below which a page without
+// a title is considered to have rendered empty.
+const minRenderedElements = 10
+
+func (a *Analyzer) findEmptyRender() {
+	title := strings.TrimSpace(a.document.Find("title").Text())
+	elements := a.document.Find("body *").Length()
+	if title == "" && elements < minRenderedElements {
+		a.warning(fmt.Sprintf("page rendered empty — possible bot block or JS error (%d elements)", elements))
+	}
+}
+
+func (a *Analyzer) findUnsafeTargetBlank() {
+	links := a.document.Find("a[target]").FilterFunction(func(_ int, s *goquery.Selection) bool {
+		if !strings.EqualFold(s.AttrOr("target", ""), "_blank") {
+			return false
+		}
+		for _, rel := range strings.Fields(strings.ToLower(s.AttrOr("rel", ""))) {
+			if rel == "noopener" || rel == "noreferrer" {
+				return false
+			}
+		}
+		return true
+	})
+	a.success(fmt.Sprintf("unsafe target=_blank links : %d", links.Length()))
+}
+
+func (a *Analyzer) findAutoplayMedia() {
+	media := a.document.Find("video[autoplay], audio[autoplay]")
+	unmuted := media.Not("[muted]").Length()
+	a.success(fmt.Sprintf("autoplay media : %d (unmuted: %d)", media.Length(), unmuted))
+}
+
+// quirksPublicIDPrefixes are the most common public identifiers which put browsers in
+// quirks mode, a subset of the list in the HTML specification.
+var quirksPublicIDPrefixes = []string{
+	"-//w3c//dtd html 3.2",
+	"-//w3c//dtd html 4.0 transitional//",
+	"-//w3c//dtd html 4.0 frameset//",
+	"-//ietf//dtd html",
+	"-//w3o//dtd w3 html strict 3.0//",
+	"-//netscape comm. corp.//dtd html//",
+	"-//microsoft//dtd internet explorer",
+}
+
+// renderingMode returns the mode a browser renders a document with the given
+// doctype in: standards, almost-standards or quirks, following the HTML specification.
+func renderingMode(doctype *html.Node) string {
+	if doctype == nil || !strings.EqualFold(doctype.Data, "html") {
+		return "quirks"
+	}
+
+	var publicID, systemID string
+	var hasSystemID bool
+	for _, attr := range doctype.Attr {
+		switch attr.Key {
+		case "public":
+			publicID = strings.ToLower(attr.Val)
+		case "system":
+			systemID = strings.ToLower(attr.Val)
+			hasSystemID = true
+		}
+	}
+
+	if systemID == "http://www.ibm.com/data/dtd/v11/ibmxhtml1-transitional.dtd" {
+		return "quirks"
+	}
+	for _, prefix := range quirksPublicIDPrefixes {
+		if strings.HasPrefix(publicID, prefix) {
+			return "quirks"
+		}
+	}
+
+	html401Loose := strings.HasPrefix(publicID, "-//w3c//dtd html 4.01 transitional//") ||
+		strings.HasPrefix(publicID, "-//w3c//dtd html 4.01 frameset//")
+	if html401Loose && !hasSystemID {
+		return "quirks"
+	}
+	if html401Loose ||
+		strings.HasPrefix(publicID, "-//w3c//dtd xhtml 1.0 transitional//") ||
+		strings.HasPrefix(publicID, "-//w3c//dtd xhtml 1.0 frameset//") {
+		return "almost-standards"
+	}
+	return "standards"
+}
+
+func (a *Analyzer) findRenderingMode() {
+	var doctype *html.Node
+	for node := a.document.Nodes[0].FirstChild; node != nil; node = node.NextSibling {
+		if node.Type == html.DoctypeNode {
+			doctype = node
+			break
+		}
+	}
+	a.success(fmt.Sprintf("rendering mode : %s", renderingMode(doctype)))
+}
+
+func (a *Analyzer) findHTTPEquivHeaders() {
+	var headers []string
+	a.document.Find("meta[http-equiv]").Each(func(_ int, s *goquery.Selection) {
+		headers = append(headers, fmt.Sprintf("%s=%s", strings.ToLower(s.AttrOr("http-equiv", "")), s.AttrOr("content", "")))
+	})
+
+	if len(headers) == 0 {
+		a.success("http-equiv headers : none")
+		return
+	}
+	a.success(fmt.Sprintf("http-equiv headers : %s", html.EscapeString(strings.Join(headers, ", "))))
+}
+
+// findXUACompatible reports the X-UA-Compatible tag, a leftover of Internet Explorer
+// document modes which modern browsers ignore.
+func (a *Analyzer) findXUACompatible() {
+	tag := a.document.Find("meta[http-equiv]").FilterFunction(func(_ int, s *goquery.Selection) bool {
+		return strings.EqualFold(strings.TrimSpace(s.AttrOr("http-equiv", "")), "x-ua-compatible")
+	}).First()
+
+	if tag.Length() == 0 {
+		a.success("x-ua-compatible : not found")
+		return
+	}
+	a.warning(fmt.Sprintf("x-ua-compatible : %s", html.EscapeString(tag.AttrOr("content", ""))))
+}
+
+// contentSecurityPolicy maps CSP directive names to their source lists.
+type contentSecurityPolicy map[string][]string
+
+// parseCSP parses a Content-Security-Policy header value.
+func parseCSP(policy string) contentSecurityPolicy {
+	csp := contentSecurityPolicy{}
+	for _, directive := range strings.Split(policy, ";") {
+		fields := strings.Fields(directive)
+		if len(fields) == 0 {
+			continue
+		}
+		name := strings.ToLower(fields[0])
+		if _, ok := csp[name]; ok {
+			continue
+		}
+		csp[name] = fields[1:]
+	}
+	return csp
+}
+
+var cspDirectives = map[string][]string{
+	kindScript:     {"script-src-elem", "script-src", "default-src"},
+	kindStylesheet: {"style-src-elem", "style-src", "default-src"},
+	kindImage:      {"img-src", "default-src"},
+	kindIframe:     {"frame-src", "child-src", "default-src"},
+	kindFont:       {"font-src", "default-src"},
+	kindMedia:      {"media-src", "default-src"},
+}
+
+// allows reports whether the policy allows loading resource on a page served from page.
+func (csp contentSecurityPolicy) allows(resource subresource, page *url.URL) bool {
+	for _, directive := range cspDirectives[resource.kind] {
+		sources, ok := csp[directive]
+		if !ok {
+			continue
+		}
+		// with 'strict-dynamic', scripts in the document are only trusted by a nonce or hash,
+		// and host and scheme sources are ignored.
+		var strictDynamic bool
+		for _, source := range sources {
+			strictDynamic = strictDynamic || (resource.kind == kindScript && strings.EqualFold(source, "'strict-dynamic'"))
+		}
+		for _, source := range sources {
+			if cspNonceOrHashMatches(source, resource) {
+				return true
+			}
+			if !strictDynamic && cspSourceMatches(strings.ToLower(source), resource.url, page) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// cspNonceOrHashMatches reports whether source is the nonce of the element of resource,
+// or one of the hashes of its integrity attribute. Nonces and hashes are case sensitive.
+func cspNonceOrHashMatches(source string, resource subresource) bool {
+	if len(source) < 2 || !strings.HasPrefix(source, "'") || !strings.HasSuffix(source, "'") {
+		return false
+	}
+	source = source[1 : len(source)-1]
+	separator := strings.IndexByte(source, '-')
+	if separator < 0 {
+		return false
+	}
+	algorithm, value := strings.ToLower(source[:separator]), source[separator+1:]
+
+	switch algorithm {
+	case "nonce":
+		return resource.nonce != "" && value == resource.nonce
+	case "sha256", "sha384", "sha512":
+		for _, hash := range strings.Fields(resource.integrity) {
+			hash = strings.SplitN(hash, "?", 2)[0]
+			if i := strings.IndexByte(hash, '-'); i >= 0 && strings.EqualFold(hash[:i], algorithm) && hash[i+1:] == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func cspSourceMatches(source string, target, page *url.URL) bool {
+	switch {
+	case source == "'none'":
+		return false
+	case source == "'self'":
+		return target.Scheme == page.Scheme && strings.EqualFold(target.Host, page.Host)
+	case source == "*":
+		return target.Scheme == "http" || target.Scheme == "https"
+	case strings.HasPrefix(source, "'"):
+		return false
+	case strings.HasSuffix(source, ":") && !strings.Contains(source, "/"):
+		return target.Scheme+":" == source
+	}
+
+	if i := strings.Index(source, "://"); i >= 0 {
+		if target.Scheme != source[:i] {
+			return false
+		}
+		source = source[i+3:]
+	}
+	if i := strings.IndexByte(source, '/'); i >= 0 {
+		source = source[:i]
+	}
+	host := source
+	if i := strings.LastIndex(source, ":"); i >= 0 {
+		host = source[:i]
+	}
+
+	targetHost := strings.ToLower(target.Hostname())
+	if strings.HasPrefix(host, "*.") {
+		return strings.HasSuffix(targetHost, host[1:])
+	}
+	return targetHost == host
+}
+
+// contentSecurityPolicy returns the policy from the response header, or else
+// from a meta http-equiv tag. ok is false when the page has no policy.
+func (a *Analyzer) contentSecurityPolicy() (policy contentSecurityPolicy, ok bool) {
+	value := a.header.Get("Content-Security-Policy")
+	if value == "" {
+		a.document.Find("meta[http-equiv]").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+			if strings.EqualFold(s.AttrOr("http-equiv", ""), "content-security-policy") {
+				value = s.AttrOr("content", "")
+				return false
+			}
+			return true
+		})
+	}
+	if strings.TrimSpace(value) == "" {
+		return nil, false
+	}
+	return parseCSP(value), true
+}
+
+// findCSPViolations reports the subresources which the page's own policy would block.
+// connect-src isn't covered since requests made from scripts aren't visible in the document.
+func (a *Analyzer) findCSPViolations() {
+	csp, ok := a.contentSecurityPolicy()
+	if !ok {
+		a.success("csp blocked resources : no policy")
+		return
+	}
+
+	page, err := url.Parse(a.requestURL)
+	if err != nil {
+		a.failure("findCSPViolations", fmt.Sprintf("csp blocked resources : %s", html.EscapeString(err.Error())))
+		return
+	}
+
+	blocked := map[string]int{}
+	var total int
+	for _, resource := range a.subresources() {
+		if !csp.allows(resource, page) {
+			blocked[resource.kind]++
+			total++
+		}
+	}
+
+	if total == 0 {
+		a.success("csp blocked resources : 0")
+		return
+	}
+	a.warning(fmt.Sprintf("csp blocked resources : %d (%s)", total, formatCounts(blocked, 0)))
+}
+
+// subresource is a resource referenced by the document, with the nonce and
+// integrity attributes of its element.
+type subresource struct {
+	kind      string
+	url       *url.URL
+	nonce     string
+	integrity string
+}
+
+const (
+	kindScript     = "script"
+	kindStylesheet = "stylesheet"
+	kindImage      = "image"
+	kindIframe     = "iframe"
+	kindFont       = "font"
+	kindMedia      = "media"
+)
+
+// subresources returns scripts, stylesheets, images, iframes, fonts and media
+// referenced by the document, resolved against the request URL.
+func (a *Analyzer) subresources() []subresource {
+	var resources []subresource
+	a.document.Find("script[src], img[src], iframe[src], link[href], video[src], audio[src], video source[src], audio source[src]").Each(func(_ int, s *goquery.Selection) {
+		var kind string
+		ref, ok := s.Attr("src")
+		switch goquery.NodeName(s) {
+		case "script":
+			kind = kindScript
+		case "img":
+			kind = kindImage
+		case "iframe":
+			kind = kindIframe
+		case "video", "audio", "source":
+			kind = kindMedia
+		case "link":
+			rel := strings.ToLower(s.AttrOr("rel", ""))
+			switch {
+			case strings.EqualFold(s.AttrOr("as", ""), "font"):
+				kind = kindFont
+			case strings.Contains(rel, "stylesheet"):
+				kind = kindStylesheet
+			default:
+				return
+			}
+			ref, ok = s.Attr("href")
+		}
+		if !ok {
+			return
+		}
+
+		resolved, err := a.resolveURL(ref)
+		if err != nil {
+			return
+		}
+		resources = append(resources, subresource{
+			kind:      kind,
+			url:       resolved,
+			nonce:     s.AttrOr("nonce", ""),
+			integrity: s.AttrOr("integrity", ""),
+		})
+	})
+	return resources
+}
+
+// subresourceURLs returns the URLs of subresources.
+func (a *Analyzer) subresourceURLs() []*url.URL {
+	resources := a.subresources()
+	urls := make([]*url.URL, 0, len(resources))
+	for _, resource := range resources {
+		urls = append(urls, resource.url)
+	}
+	return urls
+}
+
+func (a *Analyzer) resolveURL(ref string) (*url.URL, error) {
+	base, err := url.Parse(a.requestURL)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return nil, err
+	}
+	return base.ResolveReference(parsed), nil
+}
+
+// formatCounts formats counts as "key(count)" pairs ordered by count, highest first.
+// A limit of zero lists every key.
+func formatCounts(counts map[string]int, limit int) string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+	}
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s(%d)", key, counts[key]))
+	}
+	return strings.Join(pairs, ", ")
 }
@@ -0,0 +1,3794 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/mjmyaseer/webPageAnalyzer/client"
+	"golang.org/x/net/html"
+	"golang.org/x/net/websocket"
+)
+
+// analyzeMessage sends message to a websocket server running websocketHandler and
+// returns the responses until the analysis completes, or the first response
+// for messages which fail before an analysis starts.
+func analyzeMessage(t *testing.T, message string) []client.Response {
+	t.Helper()
+	return receiveUntil(t, message, func(response client.Response) bool {
+		return response.Status == client.StatusComplete || (response.Status == client.StatusFailure && response.ID == "")
+	})
+}
+
+// receiveUntil sends message to a websocket server running websocketHandler and
+// returns the responses up to the first one done reports true for.
+func receiveUntil(t *testing.T, message string, done func(client.Response) bool) []client.Response {
+	t.Helper()
+	ws := dialAnalyzer(t)
+	if err := websocket.Message.Send(ws, message); err != nil {
+		t.Fatal(err)
+	}
+	return readUntil(t, ws, done)
+}
+
+// dialAnalyzer connects to a websocket server running websocketHandler.
+func dialAnalyzer(t *testing.T) *websocket.Conn {
+	t.Helper()
+	server := httptest.NewServer(websocket.Handler(websocketHandler))
+	t.Cleanup(server.Close)
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/", "", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+// readUntil returns the responses received on ws up to the first one done reports true for.
+func readUntil(t *testing.T, ws *websocket.Conn, done func(client.Response) bool) []client.Response {
+	t.Helper()
+	if err := ws.SetReadDeadline(time.Now().Add(30 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	var responses []client.Response
+	for {
+		var data []byte
+		if err := websocket.Message.Receive(ws, &data); err != nil {
+			t.Fatalf("receiving after %d responses: %v", len(responses), err)
+		}
+		response, err := client.Decode(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		responses = append(responses, response)
+		if done(response) {
+			return responses
+		}
+	}
+}
+
+// analyzeDocument analyzes supplied html as if it was served from pageURL.
+func analyzeDocument(t *testing.T, pageURL, document string) []client.Response {
+	t.Helper()
+	message, err := json.Marshal(analyzeRequest{Type: requestTypeHTML, URL: pageURL, HTML: document})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return analyzeMessage(t, string(message))
+}
+
+// valueOf returns the value of the first response labelled label.
+func valueOf(t *testing.T, responses []client.Response, label string) string {
+	t.Helper()
+	for _, response := range responses {
+		if response.Label == label {
+			return html.UnescapeString(strings.SplitN(response.Result, " : ", 2)[1])
+		}
+	}
+	t.Fatalf("no %q result in %v", label, responses)
+	return ""
+}
+
+// hasResult reports whether a response with exactly result was sent.
+func hasResult(responses []client.Response, result string) bool {
+	for _, response := range responses {
+		if html.UnescapeString(response.Result) == result {
+			return true
+		}
+	}
+	return false
+}
+
+// hasLabel reports whether a response labelled label was sent.
+func hasLabel(responses []client.Response, label string) bool {
+	for _, response := range responses {
+		if response.Label == label {
+			return true
+		}
+	}
+	return false
+}
+
+// analyzeSite analyzes the page of request.URL.
+func analyzeSite(t *testing.T, request analyzeRequest) []client.Response {
+	t.Helper()
+	message, err := json.Marshal(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return analyzeMessage(t, string(message))
+}
+
+// injectedLoginPage adds its login form with javascript, so only a rendered
+// document contains it.
+const injectedLoginPage = `<!DOCTYPE html>
+<html>
+<head><title>Login</title></head>
+<body>
+<script>
+var form = document.createElement("form");
+form.action = "/login";
+form.innerHTML = '<input type="text" name="user"><input type="password" name="password">';
+document.body.appendChild(form);
+</script>
+</body>
+</html>`
+
+func TestFindLoginFormOnRenderedDocument(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, injectedLoginPage)
+	}))
+	defer server.Close()
+
+	responses := analyzeSite(t, analyzeRequest{URL: server.URL, Static: true})
+	if got := valueOf(t, responses, "contain login form"); got != "false" {
+		t.Errorf("contain login form of the served html = %q, want false", got)
+	}
+
+	if _, err := exec.LookPath("chromedriver"); err != nil {
+		t.Skip("chromedriver isn't on PATH")
+	}
+	if err := Setup(); err != nil {
+		t.Skipf("chrome unavailable: %v", err)
+	}
+	defer driver.Stop()
+
+	responses = analyzeSite(t, analyzeRequest{URL: server.URL})
+	if got := valueOf(t, responses, "contain login form"); got != "true" {
+		t.Errorf("contain login form of the rendered document = %q, want true", got)
+	}
+}
+
+func TestFindThirdPartyDomains(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		want     string
+	}{
+		{
+			name:     "none",
+			document: `<html><head><script src="/app.js"></script></head><body><img src="logo.png"></body></html>`,
+			want:     "0",
+		},
+		{
+			name: "several",
+			document: `<html><head>
+<script src="https://cdn.one.example/app.js"></script>
+<script src="//cdn.one.example/vendor.js"></script>
+<link rel="stylesheet" href="https://styles.two.example/site.css">
+<link rel="preload" as="font" href="https://fonts.three.example/a.woff2">
+<link rel="canonical" href="https://canonical.example/">
+</head><body>
+<img src="https://images.two.example/a.png">
+<img src="/local.png">
+<iframe src="https://video.four.example/embed"></iframe>
+<video src="HTTPS://Media.Five.Example/a.mp4"></video>
+</body></html>`,
+			want: "6 (cdn.one.example(2), fonts.three.example(1), images.two.example(1), media.five.example(1), styles.two.example(1))",
+		},
+		{
+			name: "top five",
+			document: `<html><body>
+<img src="https://a.example/1.png"><img src="https://a.example/2.png">
+<img src="https://b.example/1.png"><img src="https://c.example/1.png"><img src="https://d.example/1.png">
+<img src="https://e.example/1.png"><img src="https://f.example/1.png">
+</body></html>`,
+			want: "6 (a.example(2), b.example(1), c.example(1), d.example(1), e.example(1))",
+		},
+	}
+
+	for _, test := range tests {
+		responses := analyzeDocument(t, "https://example.com/page", test.document)
+		if got := valueOf(t, responses, "third party domains"); got != test.want {
+			t.Errorf("%s: third party domains = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestFindFonts(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		want     string
+	}{
+		{
+			name:     "none",
+			document: `<html><head><link rel="stylesheet" href="/site.css"></head><body></body></html>`,
+			want:     "none",
+		},
+		{
+			name:     "google fonts",
+			document: `<html><head><link rel="stylesheet" href="https://fonts.googleapis.com/css?family=Roboto:400,700|Open+Sans"></head><body></body></html>`,
+			want:     "fonts.googleapis.com (2 families)",
+		},
+		{
+			name: "preload and font-face",
+			document: `<html><head>
+<link rel="preload" as="font" href="https://static.example.net/fonts/brand.woff2" crossorigin>
+<style>
+@font-face { font-family: "Local Sans"; src: url(/fonts/local.woff2); }
+@font-face { font-family: Inline; src: local("Inline"); }
+</style>
+</head><body></body></html>`,
+			want: "example.com (1 families), inline (1 families), static.example.net (1 families)",
+		},
+	}
+
+	for _, test := range tests {
+		responses := analyzeDocument(t, "https://example.com/", test.document)
+		if got := valueOf(t, responses, "web fonts"); got != test.want {
+			t.Errorf("%s: web fonts = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestAnalyzeContentType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		err         string
+	}{
+		{contentType: "application/pdf", err: "unsupported content type: application/pdf"},
+		{contentType: "application/json; charset=utf-8", err: "unsupported content type: application/json"},
+		{contentType: "image/png", err: "unsupported content type: image/png"},
+		{contentType: "text/html; charset=utf-8"},
+		{contentType: "application/xhtml+xml"},
+	}
+
+	for _, test := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", test.contentType)
+			fmt.Fprint(w, "<html><head><title>Page</title></head><body></body></html>")
+		}))
+		message, err := json.Marshal(analyzeRequest{URL: server.URL, Static: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		responses := receiveUntil(t, string(message), func(response client.Response) bool {
+			return response.Status == client.StatusComplete || response.Status == client.StatusFailure
+		})
+		server.Close()
+
+		last := responses[len(responses)-1]
+		if test.err != "" {
+			if last.Status != client.StatusFailure || last.Result != test.err || len(responses) != 1 {
+				t.Errorf("%s: responses = %v, want only the failure %q", test.contentType, responses, test.err)
+			}
+			continue
+		}
+		if last.Status != client.StatusComplete {
+			t.Errorf("%s: last response = %v, want the completion", test.contentType, last)
+		}
+		if got := valueOf(t, responses, "title"); got != "Page" {
+			t.Errorf("%s: title = %q", test.contentType, got)
+		}
+	}
+}
+
+func TestSetupWithoutChrome(t *testing.T) {
+	t.Setenv("ANALYZER_CHROMEDRIVER_PATH", filepath.Join(t.TempDir(), "chromedriver"))
+	if err := Setup(); err == nil {
+		driver.Stop()
+		t.Fatal("Setup succeeded without a chromedriver")
+	}
+	if driver != nil {
+		t.Error("driver set although it didn't start")
+	}
+
+	if _, err := getHTML("http://example.com/", deviceProfiles["desktop"], func(string) {}); err == nil || !strings.Contains(err.Error(), "driver not started") {
+		t.Errorf("getHTML error = %v, want driver not started", err)
+	}
+}
+
+// lifecycle returns the progress messages of responses and the labels of the
+// results around them, in the order they were sent.
+func lifecycle(responses []client.Response) []string {
+	var stages []string
+	for _, response := range responses {
+		switch response.Status {
+		case client.StatusKeepalive:
+		case client.StatusProgress:
+			stages = append(stages, response.Result)
+		default:
+			if len(stages) == 0 || stages[len(stages)-1] != "results" {
+				stages = append(stages, "results")
+			}
+		}
+	}
+	return stages
+}
+
+func TestAnalyzeLifecycle(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><head><title>Page</title></head><body></body></html>")
+	}))
+	defer server.Close()
+	message, err := json.Marshal(analyzeRequest{URL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := exec.LookPath("chromedriver"); err != nil {
+		// without a driver the analysis stops once rendering fails, after the preflight.
+		responses := receiveUntil(t, string(message), func(response client.Response) bool {
+			return response.Status == client.StatusFailure
+		})
+		if len(responses) != 3 || responses[0].Label != "html size" || responses[1].Result != "fetching..." || responses[1].Status != client.StatusProgress {
+			t.Errorf("responses = %v, want the html size, fetching... and a failure", responses)
+		}
+		t.Skip("chromedriver isn't on PATH")
+	}
+	if err := Setup(); err != nil {
+		t.Skipf("chrome unavailable: %v", err)
+	}
+	defer driver.Stop()
+
+	responses := analyzeMessage(t, string(message))
+	want := []string{"results", "fetching...", "rendering...", "results"}
+	if got := lifecycle(responses); !reflect.DeepEqual(got, want) {
+		t.Errorf("lifecycle = %v, want %v", got, want)
+	}
+	if responses[0].Label != "html size" {
+		t.Errorf("first response = %v, want the html size", responses[0])
+	}
+	if last := responses[len(responses)-1]; last.Status != client.StatusComplete {
+		t.Errorf("last response = %v, want the completion", last)
+	}
+}
+
+func TestFindAltTextQuality(t *testing.T) {
+	tests := []struct {
+		name string
+		alt  string
+		want string
+	}{
+		{name: "filename", alt: `alt="IMG_0042.JPG"`, want: "1"},
+		{name: "generic", alt: `alt=" Image "`, want: "1"},
+		{name: "long", alt: `alt="` + strings.Repeat("a very long description ", 6) + `"`, want: "1"},
+		{name: "descriptive", alt: `alt="A red bicycle leaning against a wall"`, want: "0"},
+		{name: "decorative", alt: `alt=""`, want: "0"},
+	}
+
+	for _, test := range tests {
+		responses := analyzeDocument(t, "https://example.com/", `<html><body><img src="/a.jpg" `+test.alt+`></body></html>`)
+		if got := valueOf(t, responses, "low-quality alt text"); got != test.want {
+			t.Errorf("%s: low-quality alt text = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+// resetTransport makes the next HTTP client build the shared transport again,
+// from the environment at that time.
+func resetTransport(t *testing.T) {
+	t.Helper()
+	transport, transportOnce = nil, sync.Once{}
+	t.Cleanup(func() {
+		transport, transportOnce = nil, sync.Once{}
+	})
+}
+
+func TestNewHTTPClientTransport(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		resetTransport(t)
+		defaults := NewHTTPClient().Transport.(*http.Transport)
+		if defaults.MaxIdleConns != 100 || defaults.MaxIdleConnsPerHost != 10 || defaults.IdleConnTimeout != 90*time.Second || !defaults.ForceAttemptHTTP2 {
+			t.Errorf("transport = %+v, want the default pool", defaults)
+		}
+	})
+
+	t.Run("configured", func(t *testing.T) {
+		resetTransport(t)
+		t.Setenv("ANALYZER_MAX_IDLE_CONNS", "7")
+		t.Setenv("ANALYZER_MAX_IDLE_CONNS_PER_HOST", "3")
+		t.Setenv("ANALYZER_IDLE_CONN_TIMEOUT", "42s")
+		t.Setenv("ANALYZER_FORCE_HTTP2", "false")
+
+		configured := NewHTTPClient().Transport.(*http.Transport)
+		if configured.MaxIdleConns != 7 || configured.MaxIdleConnsPerHost != 3 || configured.IdleConnTimeout != 42*time.Second || configured.ForceAttemptHTTP2 {
+			t.Errorf("transport = %+v, want the configured pool", configured)
+		}
+		if NewHTTPClient().Transport != configured {
+			t.Error("clients don't share a transport")
+		}
+	})
+}
+
+func TestParseAnalyzeRequest(t *testing.T) {
+	tests := []struct {
+		message string
+		want    analyzeRequest
+		err     string
+	}{
+		{message: "http://example.com", want: analyzeRequest{Type: requestTypeAnalyze, URL: "http://example.com"}},
+		{message: "  https://example.com/a  ", want: analyzeRequest{Type: requestTypeAnalyze, URL: "https://example.com/a"}},
+		{
+			message: `{"url": "http://example.com"}`,
+			want:    analyzeRequest{Type: requestTypeAnalyze, URL: "http://example.com"},
+		},
+		{
+			message: `{"type": "analyze", "url": "http://example.com", "locale": "de", "device": "mobile", "static": true}`,
+			want:    analyzeRequest{Type: requestTypeAnalyze, URL: "http://example.com", Locale: "de", Device: "mobile", Static: true},
+		},
+		{message: "", err: "expected an http or https url"},
+		{message: "example.com", err: "expected an http or https url"},
+		{message: "ftp://example.com", err: "expected an http or https url"},
+		{message: "file:///etc/passwd", err: "expected an http or https url"},
+		{message: "\x00\xff garbage", err: "expected an http or https url"},
+		{message: `{"url": `, err: "malformed message"},
+		{message: `{"url": 42}`, err: "malformed message"},
+		{message: `{"url": "example.com"}`, err: "expected an http or https url"},
+		{message: `{"type": "nope", "url": "http://example.com"}`, err: "unsupported message type"},
+	}
+
+	for _, test := range tests {
+		got, err := parseAnalyzeRequest(test.message)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("parseAnalyzeRequest(%q) error = %v, want %q", test.message, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseAnalyzeRequest(%q) error = %v", test.message, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseAnalyzeRequest(%q) = %+v, want %+v", test.message, got, test.want)
+		}
+	}
+}
+
+func TestWebsocketHandlerRejectsMalformedMessages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><head><title>Page</title></head><body></body></html>")
+	}))
+	defer server.Close()
+
+	ws := dialAnalyzer(t)
+	for _, message := range []string{"garbage", `{"url": `, `{"type": "nope"}`} {
+		if err := websocket.Message.Send(ws, message); err != nil {
+			t.Fatal(err)
+		}
+		responses := readUntil(t, ws, func(client.Response) bool { return true })
+		if responses[0].Status != client.StatusFailure || responses[0].ID != "" {
+			t.Errorf("%q: response = %v, want a failure", message, responses[0])
+		}
+	}
+	if err := websocket.Message.Send(ws, []byte{0xff, 0x00, 0xfe}); err != nil {
+		t.Fatal(err)
+	}
+	if responses := readUntil(t, ws, func(client.Response) bool { return true }); responses[0].Status != client.StatusFailure {
+		t.Errorf("binary message: response = %v, want a failure", responses[0])
+	}
+
+	// the connection is still usable after malformed messages.
+	if err := websocket.Message.Send(ws, fmt.Sprintf(`{"type": "analyze", "url": %q, "static": true}`, server.URL)); err != nil {
+		t.Fatal(err)
+	}
+	responses := readUntil(t, ws, func(response client.Response) bool { return response.Status == client.StatusComplete })
+	if got := valueOf(t, responses, "title"); got != "Page" {
+		t.Errorf("title = %q", got)
+	}
+}
+
+func TestKeepaliveDuringSlowAnalysis(t *testing.T) {
+	t.Setenv("ANALYZER_KEEPALIVE_INTERVAL", "20ms")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><head><title>Slow</title></head><body></body></html>")
+	}))
+	defer server.Close()
+
+	ws := dialAnalyzer(t)
+	if err := websocket.Message.Send(ws, fmt.Sprintf(`{"url": %q, "static": true}`, server.URL)); err != nil {
+		t.Fatal(err)
+	}
+	responses := readUntil(t, ws, func(response client.Response) bool { return response.Status == client.StatusComplete })
+
+	var keepalives int
+	for _, response := range responses {
+		if response.Status == client.StatusKeepalive {
+			keepalives++
+		}
+	}
+	if keepalives < 2 {
+		t.Errorf("%d keepalives during a slow analysis, want several", keepalives)
+	}
+
+	// keepalives stop with the analysis.
+	if err := ws.SetReadDeadline(time.Now().Add(100 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	var data []byte
+	if err := websocket.Message.Receive(ws, &data); err == nil {
+		t.Errorf("received %s after the analysis completed", data)
+	}
+}
+
+func TestKeepaliveDisabled(t *testing.T) {
+	t.Setenv("ANALYZER_KEEPALIVE_INTERVAL", "0")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><head><title>Slow</title></head><body></body></html>")
+	}))
+	defer server.Close()
+
+	responses := analyzeSite(t, analyzeRequest{URL: server.URL, Static: true})
+	for _, response := range responses {
+		if response.Status == client.StatusKeepalive {
+			t.Fatal("keepalive sent although keepalives are disabled")
+		}
+	}
+	stop := startKeepalive(&responder{}, -time.Second)
+	stop()
+	stop()
+}
+
+func TestFindComments(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		want     string
+	}{
+		{name: "none", document: `<html><body><p>text</p></body></html>`, want: "0 (conditional: 0)"},
+		{
+			name:     "regular",
+			document: "<html><!-- header --><body><!-- TODO: remove\ndebug --><p>text</p><!----></body></html>",
+			want:     "3 (conditional: 0)",
+		},
+		{
+			name: "conditional",
+			document: `<html><head>
+<!--[if IE]><link rel="stylesheet" href="ie.css"><![endif]-->
+<!--[if lt IE 9]><script src="html5shiv.js"></script><![endif]-->
+<!-- [if] is only mentioned here -->
+</head><body></body></html>`,
+			want: "3 (conditional: 2)",
+		},
+	}
+
+	for _, test := range tests {
+		responses := analyzeDocument(t, "https://example.com/", test.document)
+		if got := valueOf(t, responses, "html comments"); got != test.want {
+			t.Errorf("%s: html comments = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+// servePages serves pages by path, html unless the path has an extension, and
+// records the headers of the last request of each path.
+func servePages(t *testing.T, pages map[string]string) (*httptest.Server, func(path string) http.Header) {
+	t.Helper()
+	var mutex sync.Mutex
+	headers := map[string]http.Header{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		headers[r.URL.Path] = r.Header.Clone()
+		mutex.Unlock()
+
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if path.Ext(r.URL.Path) == ".txt" {
+			w.Header().Set("Content-Type", "text/plain")
+		} else if path.Ext(r.URL.Path) == "" {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		}
+		fmt.Fprint(w, strings.ReplaceAll(page, "{{host}}", r.Host))
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func(path string) http.Header {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return headers[path]
+	}
+}
+
+func TestFindSitemap(t *testing.T) {
+	tests := []struct {
+		name  string
+		pages map[string]string
+		want  string
+	}{
+		{
+			name:  "none",
+			pages: map[string]string{"/": "<html><body></body></html>"},
+			want:  "not found",
+		},
+		{
+			name: "robots.txt",
+			pages: map[string]string{
+				"/":           "<html><body></body></html>",
+				"/robots.txt": "User-agent: *\nDisallow:\nSitemap: http://{{host}}/sitemap.xml\nsitemap:http://{{host}}/news.xml\n",
+			},
+			want: "http://{{host}}/sitemap.xml, http://{{host}}/news.xml",
+		},
+		{
+			name: "linked",
+			pages: map[string]string{
+				"/":           `<html><head><link rel="sitemap" type="application/xml" href="/sitemap.xml"></head><body></body></html>`,
+				"/robots.txt": "Sitemap: http://{{host}}/sitemap.xml\n",
+			},
+			want: "http://{{host}}/sitemap.xml",
+		},
+	}
+
+	for _, test := range tests {
+		server, _ := servePages(t, test.pages)
+		responses := analyzeSite(t, analyzeRequest{URL: server.URL, Static: true})
+		want := strings.ReplaceAll(test.want, "{{host}}", strings.TrimPrefix(server.URL, "http://"))
+		if got := valueOf(t, responses, "sitemap"); got != want {
+			t.Errorf("%s: sitemap = %q, want %q", test.name, got, want)
+		}
+	}
+}
+
+func TestFindSitemapWithoutRobotsTxt(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			// drop the connection, so fetching robots.txt fails.
+			connection, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				connection.Close()
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><head><link rel="sitemap" href="/sitemap.xml"></head><body></body></html>`)
+	}))
+	defer server.Close()
+
+	responses := analyzeSite(t, analyzeRequest{URL: server.URL, Static: true})
+	var sitemaps, warnings int
+	for _, response := range responses {
+		switch {
+		case response.Label == "sitemap":
+			sitemaps++
+		case response.Label == "robots.txt" && response.Status == client.StatusWarning:
+			warnings++
+		}
+	}
+	if sitemaps != 1 || warnings != 1 {
+		t.Errorf("%d sitemap results and %d robots.txt warnings, want one of each", sitemaps, warnings)
+	}
+	if got := valueOf(t, responses, "sitemap"); got != server.URL+"/sitemap.xml" {
+		t.Errorf("sitemap = %q", got)
+	}
+}
+
+func TestFindPreloadHints(t *testing.T) {
+	responses := analyzeDocument(t, "https://example.com/", `<html><head>
+<link rel="preconnect" href="https://cdn.example.net">
+<link rel="preconnect dns-prefetch" href="https://fonts.example.net">
+<link rel="preload" as="style" href="/site.css">
+<link rel="preload" as="font" href="/brand.woff2">
+<link rel="stylesheet" href="/site.css">
+</head><body></body></html>`)
+
+	tests := map[string]string{
+		"preconnect hints":   "2 (https://cdn.example.net, https://fonts.example.net)",
+		"preload hints":      "2 (/site.css, /brand.woff2)",
+		"dns-prefetch hints": "1 (https://fonts.example.net)",
+	}
+	for label, want := range tests {
+		if got := valueOf(t, responses, label); got != want {
+			t.Errorf("%s = %q, want %q", label, got, want)
+		}
+	}
+	for _, response := range responses {
+		if response.Label == "prefetch hints" || response.Label == "resource hints" {
+			t.Errorf("unexpected %s", response.Result)
+		}
+	}
+
+	responses = analyzeDocument(t, "https://example.com/", `<html><head><link rel="stylesheet" href="/site.css"></head><body></body></html>`)
+	if got := valueOf(t, responses, "resource hints"); got != "none" {
+		t.Errorf("resource hints = %q, want none", got)
+	}
+}
+
+func TestGetDocumentLatin1(t *testing.T) {
+	latin1 := "<html><head>%s<title>Caf\xe9 M\xfcnster</title></head><body><p>Gr\xfc\xdfe</p></body></html>"
+	tests := []struct {
+		name        string
+		contentType string
+		meta        string
+	}{
+		{name: "header", contentType: "text/html; charset=ISO-8859-1"},
+		{name: "meta", contentType: "text/html", meta: `<meta charset="iso-8859-1">`},
+		{name: "http-equiv", contentType: "text/html", meta: `<meta http-equiv="Content-Type" content="text/html; charset=windows-1252">`},
+	}
+
+	for _, test := range tests {
+		document, err := getDocument(fmt.Sprintf(latin1, test.meta), test.contentType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := document.Find("title").Text(); got != "Café Münster" {
+			t.Errorf("%s: title = %q, want Café Münster", test.name, got)
+		}
+		if got := document.Find("p").Text(); got != "Grüße" {
+			t.Errorf("%s: text = %q, want Grüße", test.name, got)
+		}
+	}
+
+	document, err := getDocument("<html><head><title>Café</title></head></html>", "text/html; charset=ISO-8859-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := document.Find("title").Text(); got != "Café" {
+		t.Errorf("utf-8 title = %q, want it unchanged", got)
+	}
+}
+
+func TestAnalyzeLatin1Page(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=ISO-8859-1")
+		fmt.Fprint(w, "<html><head><title>Caf\xe9 M\xfcnster</title></head><body></body></html>")
+	}))
+	defer server.Close()
+
+	responses := analyzeSite(t, analyzeRequest{URL: server.URL, Static: true})
+	if got := valueOf(t, responses, "title"); got != "Café Münster" {
+		t.Errorf("title = %q, want Café Münster", got)
+	}
+}
+
+func TestFindEmailAddresses(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "none", body: `<p>Contact us through the form.</p>`, want: "0 (obfuscated: 0)"},
+		{name: "mailto", body: `<a href="mailto:Sales@Example.com?subject=Hi">Write to us</a>`, want: "1 (obfuscated: 0)"},
+		{name: "plaintext", body: `<p>Mail support@example.com or jobs@example.org.</p>`, want: "2 (obfuscated: 0)"},
+		{name: "mailto and text", body: `<a href="mailto:info@example.com">info@example.com</a>`, want: "1 (obfuscated: 0)"},
+		{name: "obfuscated", body: `<p>info [at] example [dot] com</p>`, want: "0 (obfuscated: 1)"},
+	}
+
+	for _, test := range tests {
+		responses := analyzeDocument(t, "https://example.com/", "<html><body>"+test.body+"</body></html>")
+		if got := valueOf(t, responses, "email addresses"); got != test.want {
+			t.Errorf("%s: email addresses = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestFindDOMDepth(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{body: "", want: "2"},
+		{body: "<div><div><p><span>deep</span></p></div><p>shallow</p></div>", want: "6"},
+		{body: strings.Repeat("<div>", 40) + "text" + strings.Repeat("</div>", 40), want: "42"},
+	}
+
+	for _, test := range tests {
+		responses := analyzeDocument(t, "https://example.com/", "<html><head></head><body>"+test.body+"</body></html>")
+		if got := valueOf(t, responses, "max DOM depth"); got != test.want {
+			t.Errorf("max DOM depth of %q = %q, want %q", test.body, got, test.want)
+		}
+	}
+}
+
+func TestFindDuplicateIDs(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{body: `<div id="header"></div><div id="main"></div><div id="footer"></div>`, want: "none"},
+		{
+			body: `<div id="header"></div><div id="header"></div><div id="main"></div><p id="main"></p><span id="main"></span><div id="footer"></div>`,
+			want: "main(3), header(2)",
+		},
+		{body: `<div id="a&lt;b"></div><div id="a&lt;b"></div>`, want: "a<b(2)"},
+	}
+
+	for _, test := range tests {
+		responses := analyzeDocument(t, "https://example.com/", "<html><body>"+test.body+"</body></html>")
+		if got := valueOf(t, responses, "duplicate ids"); got != test.want {
+			t.Errorf("duplicate ids of %q = %q, want %q", test.body, got, test.want)
+		}
+	}
+}
+
+func TestFindTables(t *testing.T) {
+	responses := analyzeDocument(t, "https://example.com/", `<html><body>
+<table>
+<caption>Prices</caption>
+<tr><th scope="col">Item</th><th scope="col">Price</th></tr>
+<tr><td>Tea</td><td>2</td></tr>
+</table>
+<table>
+<tr><td>Item</td><td>Price</td></tr>
+<tr><td>Tea</td><td>2</td></tr>
+</table>
+<table><tr><td>layout</td></tr></table>
+</body></html>`)
+
+	tests := map[string]string{
+		"table 1": "caption true, headers true, scope true",
+		"table 2": "caption false, headers false, scope false (data table without headers)",
+		"table 3": "caption false, headers false, scope false",
+	}
+	for label, want := range tests {
+		if got := valueOf(t, responses, label); got != want {
+			t.Errorf("%s = %q, want %q", label, got, want)
+		}
+	}
+
+	responses = analyzeDocument(t, "https://example.com/", "<html><body><p>no tables</p></body></html>")
+	if got := valueOf(t, responses, "tables"); got != "none" {
+		t.Errorf("tables = %q, want none", got)
+	}
+}
+
+// sniffingListener serves TLS and plain connections on one port, telling them
+// apart by the first byte a client sends.
+type sniffingListener struct {
+	net.Listener
+	connections chan net.Conn
+}
+
+// newSniffingListener sniffs the connections of listener concurrently, so that
+// a client which hasn't sent anything yet doesn't hold up the others.
+func newSniffingListener(listener net.Listener, config *tls.Config) sniffingListener {
+	l := sniffingListener{Listener: listener, connections: make(chan net.Conn)}
+	go func() {
+		defer close(l.connections)
+		for {
+			connection, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				reader := bufio.NewReader(connection)
+				first, err := reader.Peek(1)
+				peeked := peekedConn{Conn: connection, reader: reader}
+				if err == nil && first[0] == 0x16 {
+					l.connections <- tls.Server(peeked, config)
+					return
+				}
+				l.connections <- peeked
+			}()
+		}
+	}()
+	return l
+}
+
+// peekedConn is a connection whose first bytes were buffered by reader.
+type peekedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c peekedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+func (l sniffingListener) Accept() (net.Conn, error) {
+	connection, ok := <-l.connections
+	if !ok {
+		return nil, net.ErrClosed
+	}
+	return connection, nil
+}
+
+func TestFindHTTPSUpgrade(t *testing.T) {
+	page := func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><body></body></html>")
+	}
+	secure := httptest.NewTLSServer(http.HandlerFunc(page))
+	defer secure.Close()
+
+	upgrading := httptest.NewServer(http.RedirectHandler(secure.URL+"/", http.StatusMovedPermanently))
+	defer upgrading.Close()
+
+	plain := httptest.NewServer(http.HandlerFunc(page))
+	defer plain.Close()
+
+	both := httptest.NewUnstartedServer(http.HandlerFunc(page))
+	both.Listener = newSniffingListener(both.Listener, secure.TLS)
+	both.Start()
+	defer both.Close()
+
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{name: "https", url: secure.URL, want: "page served over https"},
+		{name: "upgrade", url: upgrading.URL, want: "http redirects to https"},
+		{name: "no https", url: plain.URL, want: "https not available"},
+		{name: "no upgrade", url: both.URL, want: "https available but http does not redirect"},
+	}
+	for _, test := range tests {
+		responses := analyzeSite(t, analyzeRequest{URL: test.url, Static: true})
+		if got := valueOf(t, responses, "https upgrade"); got != test.want {
+			t.Errorf("%s: https upgrade = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestFindViewportZoom(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		warnings []string
+	}{
+		{name: "zoom friendly", content: "width=device-width, initial-scale=1"},
+		{name: "zoom allowed", content: "width=device-width, maximum-scale=5, user-scalable=yes"},
+		{name: "user-scalable=no", content: "width=device-width, user-scalable=no", warnings: []string{"user-scalable=no"}},
+		{name: "user-scalable=0", content: "width=device-width; user-scalable=0", warnings: []string{"user-scalable=0"}},
+		{name: "maximum-scale=1", content: "width=device-width, Maximum-Scale=1.0", warnings: []string{"maximum-scale=1.0"}},
+		{
+			name:     "both",
+			content:  "width=device-width, maximum-scale=1, user-scalable=no",
+			warnings: []string{"maximum-scale=1", "user-scalable=no"},
+		},
+	}
+
+	for _, test := range tests {
+		responses := analyzeDocument(t, "https://example.com/", `<html><head><meta name="viewport" content="`+test.content+`"></head><body></body></html>`)
+		if got := valueOf(t, responses, "viewport"); got != test.content {
+			t.Errorf("%s: viewport = %q", test.name, got)
+		}
+
+		var warnings []string
+		for _, response := range responses {
+			if response.Label == "viewport prevents zooming" {
+				if response.Status != client.StatusWarning {
+					t.Errorf("%s: %s has status %s, want a warning", test.name, response.Result, response.Status)
+				}
+				warnings = append(warnings, strings.SplitN(response.Result, " : ", 2)[1])
+			}
+		}
+		if !reflect.DeepEqual(warnings, test.warnings) {
+			t.Errorf("%s: warnings = %v, want %v", test.name, warnings, test.warnings)
+		}
+	}
+
+	responses := analyzeDocument(t, "https://example.com/", "<html><head></head><body></body></html>")
+	if got := valueOf(t, responses, "viewport"); got != "not found" {
+		t.Errorf("viewport = %q, want not found", got)
+	}
+}
+
+func TestParseAnalyzeRequestHTML(t *testing.T) {
+	request, err := parseAnalyzeRequest(`{"type": "html", "html": "<p>hi</p>"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (analyzeRequest{Type: requestTypeHTML, HTML: "<p>hi</p>"}); !reflect.DeepEqual(request, want) {
+		t.Errorf("request = %+v, want %+v", request, want)
+	}
+	if _, err = parseAnalyzeRequest(`{"type": "html", "html": "  "}`); err == nil || !strings.Contains(err.Error(), "expected html") {
+		t.Errorf("error = %v, want expected html", err)
+	}
+}
+
+func TestAnalyzeSuppliedHTML(t *testing.T) {
+	if driver != nil {
+		t.Fatal("driver started before the test")
+	}
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		atomic.AddInt32(&requests, 1)
+	}))
+	defer server.Close()
+
+	document := `<html><head><title>Build output</title><link rel="icon" href="/favicon.ico"></head>
+<body><h1>Hello</h1><a href="/about">About</a><img src="/a.png"></body></html>`
+	for _, pageURL := range []string{"", server.URL + "/"} {
+		responses := analyzeDocument(t, pageURL, document)
+		if got := valueOf(t, responses, "title"); got != "Build output" {
+			t.Errorf("%q: title = %q", pageURL, got)
+		}
+		if got := valueOf(t, responses, "h1 count"); got != "1" {
+			t.Errorf("%q: h1 count = %q", pageURL, got)
+		}
+		for _, response := range responses {
+			switch response.Label {
+			case "html size", "sitemap", "favicon", "compression", "https upgrade", "time to first byte", "total image weight":
+				t.Errorf("%q: network result %s for supplied html", pageURL, response.Result)
+			}
+			if response.Status == client.StatusFailure || response.Status == client.StatusProgress {
+				t.Errorf("%q: unexpected %s", pageURL, response.Result)
+			}
+		}
+		if last := responses[len(responses)-1]; last.Status != client.StatusComplete {
+			t.Errorf("%q: last response = %v, want the completion", pageURL, last)
+		}
+	}
+	if requests := atomic.LoadInt32(&requests); requests != 0 {
+		t.Errorf("%d requests for supplied html, want none", requests)
+	}
+}
+
+func TestFindInlineEventHandlers(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "clean", body: `<button type="button">Go</button><img src="/a.png" alt="a"><p data-on="x">one</p>`, want: "0"},
+		{name: "onclick", body: `<button onclick="go()">Go</button>`, want: "1"},
+		{name: "several", body: `<img src="/a.png" onerror="fail()" onLoad="done()"><a href="#" onmouseover="hover()">a</a>`, want: "3"},
+	}
+
+	for _, test := range tests {
+		responses := analyzeDocument(t, "https://example.com/", "<html><body>"+test.body+"</body></html>")
+		if got := valueOf(t, responses, "inline event handlers"); got != test.want {
+			t.Errorf("%s: inline event handlers = %q, want %q", test.name, got, test.want)
+		}
+	}
+
+	responses := analyzeDocument(t, "https://example.com/", `<html><body onload="init()"><p>text</p></body></html>`)
+	if got := valueOf(t, responses, "inline event handlers"); got != "1" {
+		t.Errorf("body onload: inline event handlers = %q, want 1", got)
+	}
+}
+
+func TestParseCSP(t *testing.T) {
+	csp := parseCSP("default-src 'self'; Script-Src 'self' https://cdn.example.com;; script-src https://ignored.example; img-src *")
+	want := contentSecurityPolicy{
+		"default-src": {"'self'"},
+		"script-src":  {"'self'", "https://cdn.example.com"},
+		"img-src":     {"*"},
+	}
+	if !reflect.DeepEqual(csp, want) {
+		t.Errorf("parseCSP = %v, want %v", csp, want)
+	}
+}
+
+func TestCSPSourceMatches(t *testing.T) {
+	page, _ := url.Parse("https://example.com/")
+	tests := []struct {
+		source, target string
+		want           bool
+	}{
+		{"'self'", "https://example.com/a.js", true},
+		{"'self'", "http://example.com/a.js", false},
+		{"'none'", "https://example.com/a.js", false},
+		{"'unsafe-inline'", "https://example.com/a.js", false},
+		{"*", "https://other.example/a.js", true},
+		{"*", "data:image/png;base64,AA", false},
+		{"data:", "data:image/png;base64,AA", true},
+		{"https:", "https://other.example/a.js", true},
+		{"https:", "http://other.example/a.js", false},
+		{"cdn.example.com", "https://cdn.example.com/a.js", true},
+		{"https://cdn.example.com", "http://cdn.example.com/a.js", false},
+		{"*.example.com", "https://static.example.com/a.js", true},
+		{"*.example.com", "https://example.com/a.js", false},
+		{"cdn.example.com:443/scripts/", "https://cdn.example.com/a.js", true},
+	}
+
+	for _, test := range tests {
+		target, _ := url.Parse(test.target)
+		if got := cspSourceMatches(test.source, target, page); got != test.want {
+			t.Errorf("cspSourceMatches(%q, %q) = %t, want %t", test.source, test.target, got, test.want)
+		}
+	}
+}
+
+func TestCSPAllows(t *testing.T) {
+	page, _ := url.Parse("https://example.com/page")
+	resource := func(kind, target, nonce, integrity string) subresource {
+		parsed, _ := url.Parse(target)
+		return subresource{kind: kind, url: parsed, nonce: nonce, integrity: integrity}
+	}
+
+	tests := []struct {
+		name     string
+		policy   string
+		resource subresource
+		want     bool
+	}{
+		{"allowlisted host", "script-src https://cdn.example.com", resource(kindScript, "https://cdn.example.com/a.js", "", ""), true},
+		{"other host", "script-src https://cdn.example.com", resource(kindScript, "https://evil.example/a.js", "", ""), false},
+		{"default-src fallback", "default-src 'self'", resource(kindStylesheet, "https://cdn.example.com/a.css", "", ""), false},
+		{"no directive", "img-src 'self'", resource(kindScript, "https://evil.example/a.js", "", ""), true},
+		{"nonce", "script-src 'nonce-R4nd0m'", resource(kindScript, "https://evil.example/a.js", "R4nd0m", ""), true},
+		{"nonce is case sensitive", "script-src 'nonce-R4nd0m'", resource(kindScript, "https://evil.example/a.js", "r4nd0m", ""), false},
+		{"missing nonce", "script-src 'nonce-R4nd0m'", resource(kindScript, "https://evil.example/a.js", "", ""), false},
+		{"style nonce", "style-src 'nonce-abc'", resource(kindStylesheet, "https://cdn.example.com/a.css", "abc", ""), true},
+		{"hash", "script-src 'sha384-AbC+/='", resource(kindScript, "https://evil.example/a.js", "", "sha256-x sha384-AbC+/=?opt"), true},
+		{"other hash", "script-src 'sha384-AbC+/='", resource(kindScript, "https://evil.example/a.js", "", "sha384-abc+/="), false},
+		{"strict-dynamic ignores hosts", "script-src 'strict-dynamic' 'nonce-abc' https://cdn.example.com 'self'", resource(kindScript, "https://cdn.example.com/a.js", "", ""), false},
+		{"strict-dynamic with nonce", "script-src 'strict-dynamic' 'nonce-abc' https://cdn.example.com", resource(kindScript, "https://evil.example/a.js", "abc", ""), true},
+		{"strict-dynamic from default-src", "default-src 'strict-dynamic' 'nonce-abc' 'self'", resource(kindScript, "https://example.com/a.js", "", ""), false},
+		{"strict-dynamic only applies to scripts", "default-src 'strict-dynamic' 'self'", resource(kindImage, "https://example.com/a.png", "", ""), true},
+	}
+	for _, test := range tests {
+		if got := parseCSP(test.policy).allows(test.resource, page); got != test.want {
+			t.Errorf("%s: allows = %t, want %t", test.name, got, test.want)
+		}
+	}
+}
+
+func TestFindCSPViolations(t *testing.T) {
+	resources := `<script src="https://cdn.example.com/app.js"></script>
+<script src="https://evil.example/track.js"></script>
+<script nonce="n0nce" src="https://other.example/loader.js"></script>
+<img src="https://images.example.net/a.png"><img src="/b.png">`
+
+	tests := []struct {
+		name, policy, want string
+	}{
+		{name: "no policy", want: "no policy"},
+		{name: "permissive", policy: "default-src *", want: "0"},
+		{name: "restrictive", policy: "script-src 'self' https://cdn.example.com; img-src 'self'", want: "3 (script(2), image(1))"},
+		{name: "nonce", policy: "script-src 'self' https://cdn.example.com 'nonce-n0nce'; img-src *", want: "1 (script(1))"},
+		{name: "strict-dynamic", policy: "script-src 'strict-dynamic' 'nonce-n0nce' https://cdn.example.com; img-src *", want: "2 (script(2))"},
+	}
+	for _, test := range tests {
+		meta := ""
+		if test.policy != "" {
+			meta = `<meta http-equiv="Content-Security-Policy" content="` + test.policy + `">`
+		}
+		responses := analyzeDocument(t, "https://example.com/", "<html><head>"+meta+"</head><body>"+resources+"</body></html>")
+		if got := valueOf(t, responses, "csp blocked resources"); got != test.want {
+			t.Errorf("%s: csp blocked resources = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestFindCSPViolationsFromHeader(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Security-Policy", "default-src 'self'")
+		fmt.Fprint(w, `<html><head><meta http-equiv="Content-Security-Policy" content="default-src *"></head>
+<body><img src="/a.png"><img src="https://images.example.net/a.png"></body></html>`)
+	}))
+	defer server.Close()
+
+	responses := analyzeSite(t, analyzeRequest{URL: server.URL, Static: true})
+	if got := valueOf(t, responses, "csp blocked resources"); got != "1 (image(1))" {
+		t.Errorf("csp blocked resources = %q, want the header policy to apply", got)
+	}
+}
+
+func TestScore(t *testing.T) {
+	var total int
+	for _, criterion := range scoreCriteria {
+		total += criterion.weight
+	}
+	if total != 100 {
+		t.Errorf("score weights add up to %d, want 100", total)
+	}
+
+	tests := []struct {
+		name       string
+		document   string
+		score      int
+		deductions string
+	}{
+		{
+			name: "well formed",
+			document: `<!DOCTYPE html><html lang="en"><head><title>Page</title>
+<meta name="description" content="A page"><meta name="viewport" content="width=device-width">
+</head><body><h1 id="top">Page</h1><img src="/a.png" alt="A chart"></body></html>`,
+			score: 100,
+		},
+		{
+			name:       "poor",
+			document:   `<html><head></head><body><h1 id="a">A</h1><h1 id="a">B</h1><img src="/a.png"></body></html>`,
+			score:      0,
+			deductions: "has title, has meta description, has doctype, has one h1, images have alt text, has viewport, has lang attribute, no duplicate ids",
+		},
+		{
+			name:       "missing description",
+			document:   `<!DOCTYPE html><html lang="en"><head><title>Page</title><meta name="viewport" content="width=device-width"></head><body><h1>Page</h1></body></html>`,
+			score:      85,
+			deductions: "has meta description",
+		},
+	}
+	for _, test := range tests {
+		responses := analyzeDocument(t, "https://example.com/", test.document)
+		completion, ok := responses[len(responses)-1].Parse().(client.Completion)
+		if !ok {
+			t.Fatalf("%s: last response = %v, want the completion", test.name, responses[len(responses)-1])
+		}
+		if completion.Score != test.score {
+			t.Errorf("%s: score = %d, want %d", test.name, completion.Score, test.score)
+		}
+
+		var deductions string
+		for _, response := range responses {
+			if response.Label == "score deductions" {
+				deductions = valueOf(t, responses, "score deductions")
+			}
+		}
+		if deductions != test.deductions {
+			t.Errorf("%s: score deductions = %q, want %q", test.name, deductions, test.deductions)
+		}
+	}
+}
+
+func TestFindLinksLimit(t *testing.T) {
+	document := `<html><body>
+<a href="/a">a</a><a href="/a">a again</a><a href="/b">b</a><a href="http://external.example/">x</a>
+<a href="/c">c</a><a href="/d">d</a>
+</body></html>`
+	tests := []struct {
+		limit     string
+		truncated bool
+		counts    [2]string
+		total     string
+	}{
+		{limit: "3", truncated: true, counts: [2]string{"2", "1"}, total: "6, unique : 3"},
+		{limit: "5", counts: [2]string{"4", "1"}, total: "6, unique : 5"},
+		{limit: "0", counts: [2]string{"4", "1"}, total: "6, unique : 5"},
+	}
+
+	for _, test := range tests {
+		t.Setenv("ANALYZER_MAX_LINKS", test.limit)
+		responses := analyzeDocument(t, "https://example.com/", document)
+
+		truncated := hasResult(responses, "link analysis truncated at "+test.limit+" links")
+		if truncated != test.truncated {
+			t.Errorf("limit %s: truncated = %t, want %t", test.limit, truncated, test.truncated)
+		}
+		if got := valueOf(t, responses, "internal link count"); got != test.counts[0] {
+			t.Errorf("limit %s: internal link count = %q, want %q", test.limit, got, test.counts[0])
+		}
+		if got := valueOf(t, responses, "external link count"); got != test.counts[1] {
+			t.Errorf("limit %s: external link count = %q, want %q", test.limit, got, test.counts[1])
+		}
+		if got := valueOf(t, responses, "total links"); got != test.total {
+			t.Errorf("limit %s: total links = %q, want %q", test.limit, got, test.total)
+		}
+	}
+}
+
+func TestFindResponsiveImages(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "none", body: `<p>text</p>`, want: "0 of 0 (picture elements: 0)"},
+		{name: "plain", body: `<img src="/a.jpg"><img src="/b.jpg">`, want: "0 of 2 (picture elements: 0)"},
+		{
+			name: "srcset",
+			body: `<img src="/a.jpg" srcset="/a-2x.jpg 2x"><img src="/b.jpg" srcset="/b-400.jpg 400w, /b-800.jpg 800w" sizes="50vw"><img src="/c.jpg">`,
+			want: "2 of 3 (picture elements: 0)",
+		},
+		{
+			name: "picture",
+			body: `<picture><source srcset="/a.webp" type="image/webp"><img src="/a.jpg"></picture><img src="/b.jpg">`,
+			want: "1 of 2 (picture elements: 1)",
+		},
+	}
+
+	for _, test := range tests {
+		responses := analyzeDocument(t, "https://example.com/", "<html><body>"+test.body+"</body></html>")
+		if got := valueOf(t, responses, "responsive images"); got != test.want {
+			t.Errorf("%s: responsive images = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestPreflightTimeToFirstByte(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		fmt.Fprint(w, "<html></html>")
+	}))
+	defer slow.Close()
+
+	response, timing, err := preflight(analyzeRequest{URL: slow.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if timing.firstByte < 100*time.Millisecond || timing.firstByte > 5*time.Second {
+		t.Errorf("time to first byte = %s, want the delay of the server", timing.firstByte)
+	}
+
+	// a slow redirect isn't part of the timings of the page it redirects to.
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, "<html></html>")
+	}))
+	defer fast.Close()
+	redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+		http.Redirect(w, r, fast.URL, http.StatusFound)
+	}))
+	defer redirect.Close()
+
+	response, timing, err = preflight(analyzeRequest{URL: redirect.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if timing.firstByte >= 300*time.Millisecond || timing.connect >= 300*time.Millisecond {
+		t.Errorf("time to first byte = %s, connect = %s, want the timings of the final hop", timing.firstByte, timing.connect)
+	}
+}
+
+func TestFindTimeToFirstByte(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html></html>")
+	}))
+	defer server.Close()
+
+	responses := analyzeSite(t, analyzeRequest{URL: server.URL, Static: true})
+	firstByte, err := time.ParseDuration(valueOf(t, responses, "time to first byte"))
+	if err != nil || firstByte < 50*time.Millisecond {
+		t.Errorf("time to first byte = %s, %v, want at least the delay of the server", firstByte, err)
+	}
+}
+
+func TestPreflightConnectionTiming(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, "<html></html>")
+	}))
+	defer server.Close()
+	// a host name, rather than the address of the server, needs a dns lookup.
+	pageURL := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+
+	response, timing, err := preflight(analyzeRequest{URL: pageURL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if timing.dnsStart.IsZero() || timing.connectStart.IsZero() || timing.tlsStart.IsZero() {
+		t.Errorf("timing = %+v, want the dns, connect and tls hooks to fire", timing)
+	}
+	if timing.dns < 0 || timing.connect <= 0 || timing.tls <= 0 || timing.reusedConn {
+		t.Errorf("dns = %s, connect = %s, tls = %s, reused %t, want the timings of a new connection", timing.dns, timing.connect, timing.tls, timing.reusedConn)
+	}
+
+	// the shared transport keeps the connection for the next request to the host.
+	response, timing, err = preflight(analyzeRequest{URL: pageURL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if !timing.reusedConn || timing.dns != 0 || timing.connect != 0 || timing.tls != 0 {
+		t.Errorf("dns = %s, connect = %s, tls = %s, reused %t, want a reused connection", timing.dns, timing.connect, timing.tls, timing.reusedConn)
+	}
+}
+
+func TestFindTiming(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html></html>")
+	}))
+	defer server.Close()
+
+	responses := analyzeSite(t, analyzeRequest{URL: server.URL, Static: true})
+	var timings int
+	for _, response := range responses {
+		// timings are rounded to milliseconds, which a local connection takes less than.
+		if timing, ok := response.Parse().(client.ConnectionTiming); ok {
+			timings++
+			if timing.DNS < 0 || timing.Connect < 0 || timing.TLS != 0 {
+				t.Errorf("timing = %+v, want non-negative timings without tls", timing)
+			}
+		}
+	}
+	if timings != 1 {
+		t.Errorf("%d connection timings, want one", timings)
+	}
+	if got := valueOf(t, responses, "connection reused"); got != "false" {
+		t.Errorf("connection reused = %q", got)
+	}
+}
+
+func TestForEachConcurrentlyPanic(t *testing.T) {
+	var mutex sync.Mutex
+	var called []string
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Errorf("recovered %v, want the panic of the call", r)
+		}
+		if len(called) != 2 {
+			t.Errorf("called %v, want the calls which did not panic to run", called)
+		}
+	}()
+	forEachConcurrently(context.Background(), []string{"a", "b", "c"}, 1, func(item string) {
+		if item == "b" {
+			panic("boom")
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		called = append(called, item)
+	})
+	t.Error("forEachConcurrently returned, want the panic raised in the caller")
+}
+
+func TestPanickingCheck(t *testing.T) {
+	server := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		document, err := goquery.NewDocumentFromReader(strings.NewReader("<html><title>Title</title></html>"))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		analyzer := NewAnalyzer(newResponder(ws, "en"), "http://example.com/", "", document)
+		analyzer.concur(analyzerCheck{name: "findTitle", run: (*Analyzer).findTitle})
+		analyzer.concur(analyzerCheck{name: "panics", run: func(*Analyzer) { panic("boom") }})
+		analyzer.concur(analyzerCheck{name: "panicsConcurrently", run: func(a *Analyzer) {
+			forEachConcurrently(a.ctx, []string{"a"}, 1, func(string) { panic("boom") })
+		}})
+		analyzer.Wait()
+		analyzer.Complete()
+	}))
+	defer server.Close()
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/", "", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	responses := readUntil(t, ws, func(response client.Response) bool {
+		return response.Status == client.StatusComplete
+	})
+	if got := valueOf(t, responses, "title"); got != "Title" {
+		t.Errorf("title = %q, want the result of the check which did not panic", got)
+	}
+	for _, want := range []string{"check failed : boom (check panics)", "check failed : boom (check panicsConcurrently)"} {
+		if !hasResult(responses, want) {
+			t.Errorf("responses = %v, want %q naming the panicking check", responses, want)
+		}
+	}
+}
+
+func TestFindImageFormats(t *testing.T) {
+	tests := []struct {
+		name, body, formats string
+		legacy              bool
+	}{
+		{"mixed", `<img src="a.jpg"><img src="b.JPEG?v=2"><img src="c.png"><img src="d.webp">
+			<picture><source type="image/avif" srcset="e.avif"><img src="e.gif"></picture>
+			<img src="data:image/svg+xml;base64,PHN2Zz4=">`, "jpg(2), avif(1), gif(1), png(1), svg(1), webp(1)", true},
+		{"modern", `<img src="a.webp"><img src="b.webp"><img src="c.avif"><img src="d.jpg">`, "webp(2), avif(1), jpg(1)", false},
+		{"none", `<p>no images</p>`, "none", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responses := analyzeDocument(t, "http://example.com/", "<html><body>"+test.body+"</body></html>")
+			if got := valueOf(t, responses, "image formats"); got != test.formats {
+				t.Errorf("image formats = %q, want %q", got, test.formats)
+			}
+			if got := hasLabel(responses, "legacy image formats"); got != test.legacy {
+				t.Errorf("legacy image formats warning %t, want %t", got, test.legacy)
+			}
+		})
+	}
+}
+
+func TestFindNoscript(t *testing.T) {
+	tests := []struct {
+		name, body, noscript string
+		warning              bool
+	}{
+		{"fallback", `<script src="app.js"></script><noscript><p>Please enable javascript.</p></noscript>`, "1 (meaningful fallback: true)", false},
+		{"empty fallback", `<script src="app.js"></script><noscript><img src="pixel.gif"></noscript>`, "1 (meaningful fallback: false)", true},
+		{"no fallback", `<div id="app"></div><script src="app.js"></script>`, "0 (meaningful fallback: false)", true},
+		{"no javascript", `<p>static</p>`, "0 (meaningful fallback: false)", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responses := analyzeDocument(t, "http://example.com/", "<html><body>"+test.body+"</body></html>")
+			if got := valueOf(t, responses, "noscript blocks"); got != test.noscript {
+				t.Errorf("noscript blocks = %q, want %q", got, test.noscript)
+			}
+			if got := hasLabel(responses, "noscript fallback"); got != test.warning {
+				t.Errorf("noscript fallback warning %t, want %t", got, test.warning)
+			}
+		})
+	}
+}
+
+func TestFindAbsoluteInternalLinks(t *testing.T) {
+	responses := analyzeDocument(t, "https://example.com/docs/", `<html><body>
+		<a href="https://example.com/about">about</a>
+		<a href="http://EXAMPLE.com/contact">contact</a>
+		<a href="//example.com/blog">blog</a>
+		<a href="https://example.com/about">about again</a>
+		<a href="/pricing">pricing</a>
+		<a href="guide">guide</a>
+		<a href="https://www.example.com/">www</a>
+		<a href="https://other.org/">other</a>
+	</body></html>`)
+	if got := valueOf(t, responses, "absolute internal links"); got != "3" {
+		t.Errorf("absolute internal links = %q, want the distinct absolute links to the page's host", got)
+	}
+}
+
+func TestFindPaginationLinks(t *testing.T) {
+	tests := []struct {
+		name, head, body, pagination string
+	}{
+		{"link tags", `<link rel="next" href="/articles?page=3"><link rel="prev" href="/articles?page=1">`, "",
+			"next=https://example.com/articles?page=3, prev=https://example.com/articles?page=1"},
+		{"anchors", "", `<a rel="nofollow previous" href="page1.html">back</a><a rel="NEXT" href="page3.html">more</a>`,
+			"next=https://example.com/articles/page3.html, prev=https://example.com/articles/page1.html"},
+		{"next only", `<link rel="next" href="https://example.com/articles/2">`, "", "next=https://example.com/articles/2"},
+		{"none", "", `<a href="/articles/2">2</a>`, "none"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responses := analyzeDocument(t, "https://example.com/articles/page2.html",
+				"<html><head>"+test.head+"</head><body>"+test.body+"</body></html>")
+			if got := valueOf(t, responses, "pagination"); got != test.pagination {
+				t.Errorf("pagination = %q, want %q", got, test.pagination)
+			}
+		})
+	}
+}
+
+func TestVersionHandler(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	versionHandler(recorder, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+	if got := recorder.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("content type = %q", got)
+	}
+	var info map[string]string
+	if err := json.NewDecoder(recorder.Body).Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"version": "dev", "commit": "none", "goVersion": runtime.Version()}
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("version = %v, want %v", info, want)
+	}
+}
+
+func TestAnalysisID(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	document := "<html><head><title>Title</title></head><body><h1>Heading</h1></body></html>"
+	first := analyzeDocument(t, "http://example.com/", document)
+	log.SetOutput(os.Stderr)
+	second := analyzeDocument(t, "http://example.com/", document)
+
+	id := first[0].ID
+	if len(id) != 12 {
+		t.Errorf("id = %q, want a short random id", id)
+	}
+	for _, response := range first {
+		if response.ID != id {
+			t.Errorf("response %v has id %q, want the id of its analysis %q", response, response.ID, id)
+		}
+	}
+	if !strings.Contains(logs.String(), "["+id+"] analyzing supplied html") {
+		t.Errorf("logs = %q, want the analysis logged with its id", logs.String())
+	}
+	if second[0].ID == id {
+		t.Errorf("two analyses both have id %q", id)
+	}
+}
+
+func TestFindLargestContentfulElement(t *testing.T) {
+	tests := []struct {
+		name, body, element string
+	}{
+		{"largest image", `<img src="icon.png" width="32" height="32">
+			<img src="hero.jpg" width="1200px" height="600">
+			<img src="banner.jpg" width="1000" height="300">
+			<img src="unsized.jpg"><p>` + strings.Repeat("text ", 100) + `</p>`, "img[src=hero.jpg]"},
+		{"longest text", `<img src="unsized.jpg"><h1>Title</h1><p>short</p><li>a much longer list item</li>`, "li (23 characters)"},
+		{"empty", `<div></div>`, "none"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responses := analyzeDocument(t, "http://example.com/", "<html><body>"+test.body+"</body></html>")
+			if got := valueOf(t, responses, "likely LCP element"); got != test.element {
+				t.Errorf("likely LCP element = %q, want %q", got, test.element)
+			}
+		})
+	}
+}
+
+func TestFindTextToHTMLRatio(t *testing.T) {
+	// 250 characters of visible text, a script and a comment padding the page to 1000 bytes.
+	start := "<html><body><p>" + strings.Repeat("a", 250) + "</p><script>var text = 'not visible';</script><!--"
+	end := "--></body></html>"
+	document := start + strings.Repeat("x", 1000-len(start)-len(end)) + end
+
+	responses := analyzeDocument(t, "http://example.com/", document)
+	if got := valueOf(t, responses, "text-to-html ratio"); got != "25%" {
+		t.Errorf("text-to-html ratio = %q, want 25%%", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/old", http.RedirectHandler("/page", http.StatusMovedPermanently))
+	mux.HandleFunc("/page", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><head><title>Page</title></head></html>")
+	})
+	mux.HandleFunc("/report.pdf", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		fmt.Fprint(w, "%PDF-1.4")
+	})
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "<html><head><title>Not found</title></head></html>")
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name, path, status, failure string
+		redirects                   string
+	}{
+		{"redirected page", "/old", "200", "", "1 (" + server.URL + "/page)"},
+		{"not found", "/missing", "404", "unexpected status code: 404", "0"},
+		{"not html", "/report.pdf", "200", "unsupported content type: application/pdf", "0"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			message, err := json.Marshal(analyzeRequest{Type: requestTypeValidate, URL: server.URL + test.path})
+			if err != nil {
+				t.Fatal(err)
+			}
+			responses := receiveUntil(t, string(message), func(response client.Response) bool {
+				return response.Status == client.StatusComplete || response.Status == client.StatusFailure
+			})
+
+			if got := valueOf(t, responses, "status code"); got != test.status {
+				t.Errorf("status code = %q, want %q", got, test.status)
+			}
+			if got := valueOf(t, responses, "redirects"); got != test.redirects {
+				t.Errorf("redirects = %q, want %q", got, test.redirects)
+			}
+			last := responses[len(responses)-1]
+			if test.failure == "" && last.Status != client.StatusComplete {
+				t.Errorf("last response = %v, want the validation completed", last)
+			}
+			if test.failure != "" && (last.Status != client.StatusFailure || !strings.Contains(html.UnescapeString(last.Result), test.failure)) {
+				t.Errorf("last response = %v, want failure %q", last, test.failure)
+			}
+			// without a driver a rendered page would fail, so validation never renders.
+			for _, response := range responses {
+				if response.Status == client.StatusProgress || hasLabel([]client.Response{response}, "title") {
+					t.Errorf("response %v, want no page fetched or analyzed", response)
+				}
+			}
+		})
+	}
+}
+
+func TestRedirectsOf(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/a", http.RedirectHandler("/b", http.StatusMovedPermanently))
+	mux.Handle("/b", http.RedirectHandler("/c", http.StatusFound))
+	mux.HandleFunc("/c", func(w http.ResponseWriter, _ *http.Request) {})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	response, _, err := preflight(analyzeRequest{URL: server.URL + "/a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	want := []string{server.URL + "/b", server.URL + "/c"}
+	if got := redirectsOf(response); !reflect.DeepEqual(got, want) {
+		t.Errorf("redirectsOf = %v, want %v", got, want)
+	}
+
+	response, _, err = preflight(analyzeRequest{URL: server.URL + "/c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if got := redirectsOf(response); len(got) != 0 {
+		t.Errorf("redirectsOf without redirects = %v, want none", got)
+	}
+}
+
+func TestInternalHosts(t *testing.T) {
+	document := `<html><body>
+		<a href="/about">about</a>
+		<a href="https://example.com/contact">contact</a>
+		<a href="https://www.example.com/">www</a>
+		<a href="https://CDN.example.net/guide.pdf">guide</a>
+		<a href="https://blog.example.com/">blog</a>
+		<a href="https://other.org/">other</a>
+	</body></html>`
+	tests := []struct {
+		name, hosts        string
+		internal, external string
+	}{
+		{"default", "", "2", "4"},
+		{"configured", " www.example.com, cdn.example.net ", "4", "2"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("ANALYZER_INTERNAL_HOSTS", test.hosts)
+			responses := analyzeDocument(t, "https://example.com/", document)
+			if got := valueOf(t, responses, "internal link count"); got != test.internal {
+				t.Errorf("internal link count = %q, want %q", got, test.internal)
+			}
+			if got := valueOf(t, responses, "external link count"); got != test.external {
+				t.Errorf("external link count = %q, want %q", got, test.external)
+			}
+		})
+	}
+}
+
+func TestInternalSubdomains(t *testing.T) {
+	tests := []struct {
+		name, page, subdomains string
+		internal, external     string
+	}{
+		{"default", "https://example.com/", "", "1", "3"},
+		{"subdomains", "https://example.com/", "true", "2", "2"},
+		// co.uk is a public suffix, so other.co.uk is another site.
+		{"public suffix", "https://shop.example.co.uk/", "true", "2", "2"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("ANALYZER_INTERNAL_SUBDOMAINS", test.subdomains)
+			responses := analyzeDocument(t, test.page, `<html><body>
+				<a href="/about">about</a>
+				<a href="https://blog.example.com/">blog</a>
+				<a href="https://www.example.co.uk/">www</a>
+				<a href="https://other.co.uk/">other</a>
+			</body></html>`)
+			if got := valueOf(t, responses, "internal link count"); got != test.internal {
+				t.Errorf("internal link count = %q, want %q", got, test.internal)
+			}
+			if got := valueOf(t, responses, "external link count"); got != test.external {
+				t.Errorf("external link count = %q, want %q", got, test.external)
+			}
+		})
+	}
+}
+
+func TestFindMetaCharsetPosition(t *testing.T) {
+	late := "<!DOCTYPE html><html><head><!--" + strings.Repeat("x", 2048-len("<!DOCTYPE html><html><head><!---->")) + `--><meta charset="utf-8"></head></html>`
+	if offset := strings.Index(late, "<meta"); offset != 2048 {
+		t.Fatalf("fixture declares the charset at byte %d", offset)
+	}
+
+	responses := analyzeDocument(t, "http://example.com/", `<!DOCTYPE html><html><head><META Charset="utf-8"></head></html>`)
+	if got := valueOf(t, responses, "charset declaration"); got != "byte 27" {
+		t.Errorf("charset declaration = %q, want byte 27", got)
+	}
+
+	responses = analyzeDocument(t, "http://example.com/", late)
+	if !hasResult(responses, "charset declared too late (byte 2048)") {
+		t.Errorf("responses = %v, want a late charset warning", responses)
+	}
+
+	responses = analyzeDocument(t, "http://example.com/", `<html><head><meta http-equiv="content-type" content="text/html; charset=utf-8"></head></html>`)
+	if got := valueOf(t, responses, "charset declaration"); got != "byte 12" {
+		t.Errorf("charset declaration = %q, want the http-equiv declaration at byte 12", got)
+	}
+
+	responses = analyzeDocument(t, "http://example.com/", "<html><head></head></html>")
+	if got := valueOf(t, responses, "charset declaration"); got != "not found" {
+		t.Errorf("charset declaration = %q, want not found", got)
+	}
+
+	// a served page is measured as served.
+	server, _ := servePages(t, map[string]string{"/": late})
+	responses = analyzeSite(t, analyzeRequest{URL: server.URL, Static: true})
+	if !hasResult(responses, "charset declared too late (byte 2048)") {
+		t.Errorf("responses = %v, want a late charset warning for the served page", responses)
+	}
+}
+
+func TestPreflightSendsCredentials(t *testing.T) {
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+	}))
+	defer server.Close()
+
+	response, _, err := preflight(analyzeRequest{URL: server.URL, Username: "user", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if username, password, ok := (&http.Request{Header: header}).BasicAuth(); !ok || username != "user" || password != "secret" {
+		t.Errorf("basic auth = %q, %q, %t", username, password, ok)
+	}
+
+	response, _, err = preflight(analyzeRequest{URL: server.URL, Token: "token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if got := header.Get("Authorization"); got != "Bearer token" {
+		t.Errorf("Authorization = %q, want Bearer token", got)
+	}
+}
+
+func TestAnalyzeWithBasicAuth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if username, password, ok := r.BasicAuth(); !ok || username != "user" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, "<html><head><title>Sign in</title></head></html>")
+			return
+		}
+		fmt.Fprint(w, "<html><head><title>Staging</title></head></html>")
+	}))
+	defer server.Close()
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	responses := analyzeSite(t, analyzeRequest{URL: server.URL, Static: true, Username: "user", Password: "secret"})
+	log.SetOutput(os.Stderr)
+	if got := valueOf(t, responses, "title"); got != "Staging" {
+		t.Errorf("title = %q, want the title of the authenticated page", got)
+	}
+	if strings.Contains(logs.String(), "secret") {
+		t.Errorf("logs = %q, want no credentials logged", logs.String())
+	}
+}
+
+// endlessReader is an endless body which counts the bytes read from it.
+type endlessReader struct {
+	read int64
+}
+
+func (r *endlessReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 'x'
+	}
+	r.read += int64(len(p))
+	return len(p), nil
+}
+
+func TestReadBody(t *testing.T) {
+	t.Setenv("ANALYZER_MAX_BODY_BYTES", "1000")
+
+	reader := &endlessReader{}
+	body, truncated, err := readBody(&http.Response{Body: io.NopCloser(reader)})
+	if err != nil || !truncated || len(body) != 1000 {
+		t.Errorf("read %d bytes, truncated %t, %v, want the body truncated at 1000 bytes", len(body), truncated, err)
+	}
+	if reader.read > 1001 {
+		t.Errorf("read %d bytes of the body, want the read to stop at the limit", reader.read)
+	}
+
+	body, truncated, err = readBody(&http.Response{Body: io.NopCloser(strings.NewReader(strings.Repeat("x", 1000)))})
+	if err != nil || truncated || len(body) != 1000 {
+		t.Errorf("read %d bytes, truncated %t, %v, want the whole body", len(body), truncated, err)
+	}
+}
+
+func TestAnalyzeOversizedBody(t *testing.T) {
+	t.Setenv("ANALYZER_MAX_BODY_BYTES", "100")
+	server, _ := servePages(t, map[string]string{"/": "<html><head><title>Big</title></head><body>" + strings.Repeat("x", 1000) + "</body></html>"})
+
+	responses := analyzeSite(t, analyzeRequest{URL: server.URL, Static: true})
+	if !hasResult(responses, "response body truncated at 100 bytes") {
+		t.Errorf("responses = %v, want a truncation warning", responses)
+	}
+	if got := valueOf(t, responses, "title"); got != "Big" {
+		t.Errorf("title = %q, want the truncated page analyzed", got)
+	}
+}
+
+func TestFindPlatform(t *testing.T) {
+	tests := []struct {
+		name, head, body, platform string
+	}{
+		{"wordpress generator", `<meta name="generator" content="WordPress 6.4.2">`, "", "WordPress 6.4.2"},
+		{"generator without version", `<meta name="generator" content="Joomla! - Open Source Content Management">`, "", "Joomla"},
+		{"shopify asset", `<link rel="stylesheet" href="https://cdn.shopify.com/s/files/theme.css">`, "", "Shopify"},
+		{"wordpress asset", "", `<img src="/wp-content/uploads/logo.png">`, "WordPress"},
+		{"unknown", `<meta name="generator" content="Hugo 0.120">`, "", "unknown"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responses := analyzeDocument(t, "http://example.com/", "<html><head>"+test.head+"</head><body>"+test.body+"</body></html>")
+			if got := valueOf(t, responses, "platform"); got != test.platform {
+				t.Errorf("platform = %q, want %q", got, test.platform)
+			}
+		})
+	}
+}
+
+func TestFindWordCount(t *testing.T) {
+	document := `<html><body>
+		<nav>home about contact</nav>
+		<main><h1>Main title</h1> <p>four words of content</p><script>var not = "words";</script></main>
+		<div class="post">two words</div>
+		<footer>copyright</footer>
+	</body></html>`
+	tests := []struct {
+		name, document, selector string
+		words, content           string
+	}{
+		{"main", document, "", "12", "6"},
+		{"selector", document, ".post", "12", "2"},
+		{"article", "<html><body><header>site</header> <article>one two three</article> <article>four</article></body></html>", "", "5", "4"},
+		{"no main content", "<html><body><div>one two three</div></body></html>", "", "3", "no main content found"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responses := analyzeSite(t, analyzeRequest{Type: requestTypeHTML, URL: "http://example.com/", HTML: test.document, ContentSelector: test.selector})
+			if got := valueOf(t, responses, "word count"); got != test.words {
+				t.Errorf("word count = %q, want %q", got, test.words)
+			}
+			if got := valueOf(t, responses, "content word count"); got != test.content {
+				t.Errorf("content word count = %q, want %q", got, test.content)
+			}
+		})
+	}
+}
+
+func TestFindExternalFormActions(t *testing.T) {
+	tests := []struct {
+		name, forms, hosts string
+		actions            []string
+	}{
+		{"same origin", `<form action="https://example.com/login"></form>`, "", nil},
+		{"relative", `<form action="/search"></form><form action="subscribe"></form>`, "", nil},
+		{"cross origin", `<form action="https://evil.example/collect"></form><form action="/search"></form>
+			<form action="//tracker.example/submit"></form>`, "", []string{"https://evil.example/collect", "https://tracker.example/submit"}},
+		{"internal host", `<form action="https://accounts.example.net/login"></form>`, "accounts.example.net", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("ANALYZER_INTERNAL_HOSTS", test.hosts)
+			responses := analyzeDocument(t, "https://example.com/page", "<html><body>"+test.forms+"</body></html>")
+			var actions []string
+			for _, response := range responses {
+				if response.Label == "cross-origin form action" {
+					actions = append(actions, html.UnescapeString(strings.SplitN(response.Result, " : ", 2)[1]))
+				}
+			}
+			if !reflect.DeepEqual(actions, test.actions) {
+				t.Errorf("cross-origin form actions = %v, want %v", actions, test.actions)
+			}
+			if len(test.actions) == 0 && !hasResult(responses, "cross-origin form actions : 0") {
+				t.Errorf("responses = %v, want no cross-origin form actions", responses)
+			}
+		})
+	}
+}
+
+func TestFindDataAttributes(t *testing.T) {
+	var items strings.Builder
+	for i := 0; i < 40; i++ {
+		fmt.Fprintf(&items, `<li data-id="%d">item</li>`, i)
+	}
+	for i := 0; i < 12; i++ {
+		items.WriteString(`<button data-toggle="modal" DATA-Target="#m">open</button>`)
+	}
+	for i := 0; i < 11; i++ {
+		fmt.Fprintf(&items, `<span data-x%d="1"></span>`, i)
+	}
+
+	responses := analyzeDocument(t, "http://example.com/", "<html><body><ul>"+items.String()+"</ul></body></html>")
+	want := "75 (data-id(40), data-target(12), data-toggle(12), data-x0(1), data-x1(1), data-x10(1), data-x2(1), data-x3(1), data-x4(1), data-x5(1))"
+	if got := valueOf(t, responses, "data attributes"); got != want {
+		t.Errorf("data attributes = %q, want %q", got, want)
+	}
+
+	responses = analyzeDocument(t, "http://example.com/", `<html><body><div id="data-id" class="x">no data</div></body></html>`)
+	if got := valueOf(t, responses, "data attributes"); got != "0" {
+		t.Errorf("data attributes = %q, want 0", got)
+	}
+}
+
+func TestReferer(t *testing.T) {
+	server, headers := servePages(t, map[string]string{"/": "<html><head><title>Page</title></head></html>"})
+
+	analyzeSite(t, analyzeRequest{URL: server.URL, Static: true})
+	if got := headers("/").Get("Referer"); got != "" {
+		t.Errorf("Referer = %q, want none by default", got)
+	}
+
+	analyzeSite(t, analyzeRequest{URL: server.URL, Static: true, Referer: "http://referer.example/"})
+	for _, path := range []string{"/", "/robots.txt"} {
+		if got := headers(path).Get("Referer"); got != "http://referer.example/" {
+			t.Errorf("Referer of %s = %q, want the configured referer", path, got)
+		}
+	}
+}
+
+func TestFindCompression(t *testing.T) {
+	page := "<html><head><title>Page</title></head><body>" + strings.Repeat("text ", 100) + "</body></html>"
+	tests := []struct {
+		name, encoding, compression string
+		status                      client.Status
+	}{
+		{"gzip", "gzip", "gzip", client.StatusSuccess},
+		{"brotli", "br", "br", client.StatusSuccess},
+		{"none", "", "none", client.StatusWarning},
+		{"identity", "identity", "none", client.StatusWarning},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mutex sync.Mutex
+			var acceptEncodings []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/" {
+					http.NotFound(w, r)
+					return
+				}
+				mutex.Lock()
+				acceptEncodings = append(acceptEncodings, r.Header.Get("Accept-Encoding"))
+				mutex.Unlock()
+
+				w.Header().Set("Content-Type", "text/html")
+				switch test.encoding {
+				case "gzip":
+					w.Header().Set("Content-Encoding", "gzip")
+					writer := gzip.NewWriter(w)
+					fmt.Fprint(writer, page)
+					writer.Close()
+				case "br":
+					// the check only reads the advertised encoding, not the body.
+					w.Header().Set("Content-Encoding", "br")
+				default:
+					w.Header().Set("Content-Encoding", test.encoding)
+					fmt.Fprint(w, page)
+				}
+			}))
+			defer server.Close()
+
+			responses := analyzeSite(t, analyzeRequest{URL: server.URL, Static: true})
+			for _, response := range responses {
+				if response.Label == "compression" {
+					if got := html.UnescapeString(strings.SplitN(response.Result, " : ", 2)[1]); got != test.compression || response.Status != test.status {
+						t.Errorf("compression = %q, %v, want %q, %v", got, response.Status, test.compression, test.status)
+					}
+				}
+			}
+			if !hasLabel(responses, "compression") {
+				t.Errorf("responses = %v, want a compression result", responses)
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			var advertised bool
+			for _, acceptEncoding := range acceptEncodings {
+				if acceptEncoding == "gzip, br" {
+					advertised = true
+				}
+			}
+			if !advertised {
+				t.Errorf("Accept-Encoding = %q, want gzip and br requested explicitly", acceptEncodings)
+			}
+		})
+	}
+}
+
+func TestFindSkipLink(t *testing.T) {
+	tests := []struct {
+		name, body string
+		found      bool
+	}{
+		{"skip text", `<a href="#content-start">Skip to content</a><nav><a href="/">home</a></nav>`, true},
+		{"main target", `<a href="#MAIN">Jump</a><a href="/">home</a>`, true},
+		{"third link", `<a href="/">home</a><a href="/about">about</a><a href="#main-content">content</a>`, true},
+		{"fourth link", `<a href="/">home</a><a href="/about">about</a><a href="/blog">blog</a><a href="#main">content</a>`, false},
+		{"other fragment", `<a href="#top">Top</a><a href="#">Menu</a>`, false},
+		{"skip text without fragment", `<a href="/skip">Skip to content</a>`, false},
+		{"none", `<nav><a href="/">home</a></nav>`, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responses := analyzeDocument(t, "http://example.com/", "<html><body>"+test.body+"<main id=\"main\"></main></body></html>")
+			if got := valueOf(t, responses, "skip link"); got != strconv.FormatBool(test.found) {
+				t.Errorf("skip link = %q, want %t", got, test.found)
+			}
+		})
+	}
+}
+
+func TestFindResourceSummary(t *testing.T) {
+	document := `<html><head>
+		<link rel="stylesheet" href="/site.css">
+		<link rel="stylesheet" href="https://cdn.example.net/lib.css">
+		<script src="/app.js"></script>
+		<script src="https://www.googletagmanager.com/gtag.js"></script>
+		<script>inline()</script>
+	</head><body>
+		<img src="/logo.png"><img src="https://static.example.com/hero.jpg">
+		<iframe src="https://www.youtube.com/embed/x"></iframe>
+		<video src="/intro.mp4"></video>
+	</body></html>`
+	tests := []struct {
+		name, hosts, subdomains, summary string
+	}{
+		{"default", "", "", "image(2), script(2), stylesheet(2), iframe(1), media(1), total 8, third party 4"},
+		{"internal hosts", "cdn.example.net", "true", "image(2), script(2), stylesheet(2), iframe(1), media(1), total 8, third party 2"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("ANALYZER_INTERNAL_HOSTS", test.hosts)
+			t.Setenv("ANALYZER_INTERNAL_SUBDOMAINS", test.subdomains)
+			responses := analyzeDocument(t, "https://example.com/", document)
+			if got := valueOf(t, responses, "resource summary"); got != test.summary {
+				t.Errorf("resource summary = %q, want %q", got, test.summary)
+			}
+		})
+	}
+
+	responses := analyzeDocument(t, "https://example.com/", "<html><body><p>text</p></body></html>")
+	if got := valueOf(t, responses, "resource summary"); got != "none" {
+		t.Errorf("resource summary = %q, want none", got)
+	}
+}
+
+func TestFindThirdPartyDomainsInternalHosts(t *testing.T) {
+	t.Setenv("ANALYZER_INTERNAL_HOSTS", "cdn.example.net")
+	t.Setenv("ANALYZER_INTERNAL_SUBDOMAINS", "true")
+	responses := analyzeDocument(t, "https://example.com/page", `<html><body>
+<img src="https://CDN.example.net/a.png"><img src="https://static.example.com/b.png">
+<img src="https://other.example/c.png">
+</body></html>`)
+	if got := valueOf(t, responses, "third party domains"); got != "1 (other.example(1))" {
+		t.Errorf("third party domains = %q, want the internal hosts left out", got)
+	}
+}
+
+// useIndex parses the index template for a test.
+func useIndex(t *testing.T) {
+	t.Helper()
+	parsed, err := parseIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := indexTemplate
+	indexTemplate = parsed
+	t.Cleanup(func() { indexTemplate = previous })
+}
+
+func serveIndex() *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	index(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	return recorder
+}
+
+func TestIndexEmbedded(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	t.Setenv("ANALYZER_WEBSOCKET_HOST", "analyzer.example")
+
+	useIndex(t)
+	recorder := serveIndex()
+	if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), `"ws://analyzer.example:8080/webSocket"`) {
+		t.Errorf("index = %d %q, want the embedded template rendered outside the repository", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestIndexViewDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "index.html.tpl"), []byte("custom {{.WebSocketPort}}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ANALYZER_VIEW_DIR", dir)
+	t.Setenv("ANALYZER_WEBSOCKET_PORT", "9090")
+
+	useIndex(t)
+	if recorder := serveIndex(); recorder.Body.String() != "custom 9090" {
+		t.Errorf("index = %q, want the template of the view directory", recorder.Body.String())
+	}
+
+	t.Setenv("ANALYZER_VIEW_DIR", filepath.Join(dir, "missing"))
+	if _, err := parseIndex(); err == nil {
+		t.Error("parsed a missing view directory")
+	}
+}
+
+func TestIndexParsedOnce(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "index.html.tpl")
+	if err := os.WriteFile(file, []byte("page {{.WebSocketHost}}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ANALYZER_VIEW_DIR", dir)
+	useIndex(t)
+	// requests render the parsed template, without reading the file again.
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+
+	var waitGroup sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			if recorder := serveIndex(); recorder.Code != http.StatusOK || recorder.Body.String() != "page localhost" {
+				t.Errorf("index = %d %q, want the parsed template", recorder.Code, recorder.Body.String())
+			}
+		}()
+	}
+	waitGroup.Wait()
+}
+
+func TestIndexExecuteError(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "index.html.tpl"), []byte("{{.WebSocketHost.Missing}}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ANALYZER_VIEW_DIR", dir)
+	useIndex(t)
+
+	recorder := serveIndex()
+	if recorder.Code != http.StatusInternalServerError || strings.Contains(recorder.Body.String(), "Missing") {
+		t.Errorf("index = %d %q, want a plain internal server error", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestFindPrivacyPolicyLink(t *testing.T) {
+	tests := []struct {
+		name, body     string
+		privacy, terms string
+	}{
+		{"text", `<a href="/legal/1">Privacy Policy</a><a href="/legal/2">Terms of Service</a>`, "true", "true"},
+		{"href", `<a href="/PRIVACY-notice">Your data</a><a href="/terms-and-conditions">Legal</a>`, "true", "true"},
+		{"conditions", `<a href="/legal">Conditions of use</a>`, "false", "true"},
+		{"none", `<a href="/about">About</a><p>privacy matters</p>`, "false", "false"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responses := analyzeDocument(t, "http://example.com/", "<html><body>"+test.body+"</body></html>")
+			if got := valueOf(t, responses, "privacy policy link"); got != test.privacy {
+				t.Errorf("privacy policy link = %q, want %q", got, test.privacy)
+			}
+			if got := valueOf(t, responses, "terms link"); got != test.terms {
+				t.Errorf("terms link = %q, want %q", got, test.terms)
+			}
+		})
+	}
+}
+
+func TestFindFormsWithoutAction(t *testing.T) {
+	tests := []struct {
+		name, body, forms string
+	}{
+		{"with action", `<form action="/search"></form>`, "0"},
+		{"without action", `<form></form><form action=""></form><form action="  "></form><form action="/login"></form>`, "3"},
+		{"no forms", `<p>no forms</p>`, "0"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responses := analyzeDocument(t, "http://example.com/", "<html><body>"+test.body+"</body></html>")
+			if got := valueOf(t, responses, "forms without action"); got != test.forms {
+				t.Errorf("forms without action = %q, want %q", got, test.forms)
+			}
+		})
+	}
+}
+
+func TestFindInaccessibleImages(t *testing.T) {
+	tests := []struct {
+		name, body, images string
+	}{
+		{"alt", `<img src="a.png" alt="A chart">`, "0"},
+		{"decorative", `<img src="a.png" alt=""><img src="b.png" role="presentation"><img src="c.png" role="none"><img src="d.png" aria-hidden="TRUE">`, "0"},
+		{"aria", `<img src="a.png" aria-label="Logo"><span id="caption">Caption</span><img src="b.png" aria-labelledby="caption">`, "0"},
+		{"missing name", `<img src="a.png"><img src="b.png" alt="   "><img src="c.png" aria-label=" "><img src="d.png" role="img"><img src="e.png" alt="ok">`, "4"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responses := analyzeDocument(t, "http://example.com/", "<html><body>"+test.body+"</body></html>")
+			if got := valueOf(t, responses, "images without accessible name"); got != test.images {
+				t.Errorf("images without accessible name = %q, want %q", got, test.images)
+			}
+		})
+	}
+}
+
+func TestParseAnalyzeRequestFileURLs(t *testing.T) {
+	if _, err := parseAnalyzeRequest("file:///tmp/page.html"); err == nil {
+		t.Error("file url accepted although not allowed")
+	}
+
+	t.Setenv("ANALYZER_ALLOW_FILE_URLS", "true")
+	if _, err := parseAnalyzeRequest("file:///tmp/page.html"); err != nil {
+		t.Errorf("file url rejected although allowed: %v", err)
+	}
+	if _, err := parseAnalyzeRequest(`{"type": "validate", "url": "file:///tmp/page.html"}`); err == nil {
+		t.Error("file url accepted for validation")
+	}
+}
+
+func TestAnalyzeFile(t *testing.T) {
+	fixture, err := filepath.Abs(filepath.Join("testdata", "page.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileURL := (&url.URL{Scheme: "file", Path: fixture}).String()
+
+	responses := analyzeSite(t, analyzeRequest{URL: fileURL, Static: true})
+	if last := responses[len(responses)-1]; last.Status != client.StatusFailure || last.ID != "" {
+		t.Errorf("last response = %v, want the file url rejected by default", last)
+	}
+
+	t.Setenv("ANALYZER_ALLOW_FILE_URLS", "true")
+	responses = analyzeSite(t, analyzeRequest{URL: fileURL, Static: true})
+	for label, want := range map[string]string{
+		"title":               "Local fixture",
+		"h1 count":            "1",
+		"internal link count": "1",
+		"external link count": "1",
+	} {
+		if got := valueOf(t, responses, label); got != want {
+			t.Errorf("%s = %q, want %q", label, got, want)
+		}
+	}
+	if last := responses[len(responses)-1]; last.Status != client.StatusComplete {
+		t.Errorf("last response = %v, want the analysis completed", last)
+	}
+
+	message, err := json.Marshal(analyzeRequest{URL: fileURL + ".missing", Static: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	responses = receiveUntil(t, string(message), func(response client.Response) bool {
+		return response.Status == client.StatusComplete || response.Status == client.StatusFailure
+	})
+	if last := responses[len(responses)-1]; last.Status != client.StatusFailure || !strings.Contains(last.Result, "Failed to open file") {
+		t.Errorf("last response = %v, want a missing file to fail", last)
+	}
+}
+
+func TestFindInlineImportant(t *testing.T) {
+	tests := []struct {
+		name, body, declarations string
+	}{
+		{"important", `<p style="color: red !important; margin: 0 ! IMPORTANT">a</p><div style="display:none!important">b</div>`, "3"},
+		{"plain styles", `<p style="color: red">a</p><style>p { color: blue !important }</style>`, "0"},
+		{"no styles", `<p>a</p>`, "0"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responses := analyzeDocument(t, "http://example.com/", "<html><body>"+test.body+"</body></html>")
+			if got := valueOf(t, responses, "inline !important declarations"); got != test.declarations {
+				t.Errorf("inline !important declarations = %q, want %q", got, test.declarations)
+			}
+		})
+	}
+}
+
+func TestFindMetaThemeColor(t *testing.T) {
+	tests := []struct {
+		name, head, color string
+	}{
+		{"single", `<meta name="theme-color" content=" #4285f4 ">`, "#4285f4"},
+		{"media scoped", `<meta name="theme-color" media="(prefers-color-scheme: light)" content="white">
+			<meta name="theme-color" media="(prefers-color-scheme: dark)" content="black">`,
+			"white ((prefers-color-scheme: light)), black ((prefers-color-scheme: dark))"},
+		{"none", `<meta name="description" content="page">`, "not found"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responses := analyzeDocument(t, "http://example.com/", "<html><head>"+test.head+"</head></html>")
+			if got := valueOf(t, responses, "theme color"); got != test.color {
+				t.Errorf("theme color = %q, want %q", got, test.color)
+			}
+		})
+	}
+}
+
+func TestFindPWA(t *testing.T) {
+	tests := []struct {
+		name, document                 string
+		manifest, serviceWorker, isPWA string
+	}{
+		{"pwa", `<html><head><link rel="manifest" href="/app.webmanifest"></head><body>
+			<script>if ("serviceWorker" in navigator) { navigator.serviceWorker.register("/sw.js"); }</script></body></html>`,
+			"https://example.com/app.webmanifest", "true", "true"},
+		{"manifest only", `<html><head><link rel="manifest" href="manifest.json"></head></html>`,
+			"https://example.com/app/manifest.json", "false", "false"},
+		// registration in an external script isn't visible in the page source.
+		{"external script", `<html><body><script src="/register-serviceWorker.register.js"></script></body></html>`,
+			"not found", "false", "false"},
+		{"plain", `<html><body><p>plain</p></body></html>`, "not found", "false", "false"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responses := analyzeDocument(t, "https://example.com/app/", test.document)
+			if got := valueOf(t, responses, "web app manifest"); got != test.manifest {
+				t.Errorf("web app manifest = %q, want %q", got, test.manifest)
+			}
+			if got := valueOf(t, responses, "service worker registration"); got != test.serviceWorker {
+				t.Errorf("service worker registration = %q, want %q", got, test.serviceWorker)
+			}
+			if got := valueOf(t, responses, "pwa candidate"); got != test.isPWA {
+				t.Errorf("pwa candidate = %q, want %q", got, test.isPWA)
+			}
+		})
+	}
+}
+
+func TestFindPositiveTabindex(t *testing.T) {
+	tests := []struct {
+		name, body, elements string
+	}{
+		{"positive", `<a href="/" tabindex="1">a</a><input tabindex=" 3 "><div tabindex="+2"></div>`, "3"},
+		{"zero", `<div tabindex="0"></div>`, "0"},
+		{"negative", `<div tabindex="-1"></div>`, "0"},
+		{"invalid", `<div tabindex="first"></div><div tabindex=""></div>`, "0"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responses := analyzeDocument(t, "http://example.com/", "<html><body>"+test.body+"</body></html>")
+			if got := valueOf(t, responses, "positive tabindex elements"); got != test.elements {
+				t.Errorf("positive tabindex elements = %q, want %q", got, test.elements)
+			}
+		})
+	}
+}
+
+// lineWriter passes each line written to it about url on lines.
+type lineWriter struct {
+	lines chan string
+	// url filters out lines of analyses of other urls, such as those of earlier tests.
+	url string
+}
+
+func (w lineWriter) Write(p []byte) (int, error) {
+	if line := strings.TrimSpace(string(p)); strings.Contains(line, `"url":"`+w.url) {
+		w.lines <- line
+	}
+	return len(p), nil
+}
+
+// captureAccessLog returns the access log entries of analyses of urls starting with
+// pageURL written during a test.
+func captureAccessLog(t *testing.T, pageURL string) func() accessLogEntry {
+	t.Helper()
+	lines := make(chan string, 10)
+	accessLog.Lock()
+	previous := accessLog.logger
+	accessLog.Unlock()
+	setAccessLog(log.New(lineWriter{lines, pageURL}, "", 0))
+	t.Cleanup(func() { setAccessLog(previous) })
+
+	return func() accessLogEntry {
+		t.Helper()
+		select {
+		case line := <-lines:
+			var entry accessLogEntry
+			if err := json.Unmarshal([]byte(line), &entry); err != nil {
+				t.Fatalf("access log line %q: %v", line, err)
+			}
+			return entry
+		case <-time.After(10 * time.Second):
+			t.Fatal("no access log line written")
+			return accessLogEntry{}
+		}
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	t.Setenv("ANALYZER_RERUN_CACHE_SIZE", "20")
+	server, _ := servePages(t, map[string]string{
+		"/a": "<html><head><title>A</title></head></html>",
+		"/b": "<html><head><title>B</title></head></html>",
+	})
+	nextEntry := captureAccessLog(t, server.URL)
+
+	responses := analyzeDocument(t, server.URL+"/a", "<html><head><title>A</title></head></html>")
+	id := responses[0].ID
+	entry := nextEntry()
+	if entry.ID != id || entry.URL != server.URL+"/a" || entry.ClientIP != "127.0.0.1" || entry.Status != "complete" || entry.Duration == "" || entry.Time == "" {
+		t.Errorf("access log entry = %+v, want the completed analysis %s", entry, id)
+	}
+
+	message, err := json.Marshal(analyzeRequest{Type: requestTypeRerun, ID: id, Checks: []string{"findTitle"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiveUntil(t, string(message), func(response client.Response) bool {
+		return response.Status == client.StatusComplete || response.Status == client.StatusFailure
+	})
+	if entry = nextEntry(); entry.URL != server.URL+"/a" || entry.Status != "complete" {
+		t.Errorf("access log entry = %+v, want the rerun logged with the url of its analysis", entry)
+	}
+
+	message, err = json.Marshal(analyzeRequest{Type: requestTypeBatch, URLs: []string{server.URL + "/a", server.URL + "/missing"}, Static: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiveUntil(t, string(message), func(response client.Response) bool {
+		return response.Status == client.StatusComplete && strings.HasPrefix(response.Result, "batch completed")
+	})
+	for _, want := range []accessLogEntry{{URL: server.URL + "/a", Status: "complete"}, {URL: server.URL + "/missing", Status: "failure"}} {
+		if entry = nextEntry(); entry.URL != want.URL || entry.Status != want.Status {
+			t.Errorf("access log entry = %+v, want %s %s", entry, want.Status, want.URL)
+		}
+	}
+	// the batch as a whole isn't logged in addition to its urls.
+	analyzeDocument(t, server.URL+"/b", "<html></html>")
+	if entry = nextEntry(); entry.URL != server.URL+"/b" {
+		t.Errorf("access log entry = %+v, want no entry for the batch itself", entry)
+	}
+}
+
+func TestFindEmptyRender(t *testing.T) {
+	const warning = "page rendered empty — possible bot block or JS error"
+	tests := []struct {
+		name, document string
+		elements       int
+	}{
+		{"empty", `<html><head></head><body><div id="root"></div><noscript>enable javascript</noscript></body></html>`, 2},
+		{"titled", `<html><head><title>Blocked</title></head><body></body></html>`, -1},
+		{"content", "<html><body>" + strings.Repeat("<p>paragraph</p>", 10) + "</body></html>", -1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responses := analyzeDocument(t, "http://example.com/", test.document)
+			var got string
+			for _, response := range responses {
+				if strings.HasPrefix(html.UnescapeString(response.Result), warning) {
+					got = html.UnescapeString(response.Result)
+				}
+			}
+			want := fmt.Sprintf("%s (%d elements)", warning, test.elements)
+			if test.elements < 0 {
+				want = ""
+			}
+			if got != want {
+				t.Errorf("empty render warning = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestFindUnsafeTargetBlank(t *testing.T) {
+	tests := []struct {
+		name, body, links string
+	}{
+		{"without rel", `<a href="https://a.example/" target="_blank">a</a><a href="https://b.example/" target="_BLANK" rel="nofollow">b</a>`, "2"},
+		{"noopener", `<a href="https://a.example/" target="_blank" rel="noopener">a</a><a href="https://b.example/" target="_blank" rel="external NoReferrer">b</a>`, "0"},
+		{"other targets", `<a href="/a" target="_self">a</a><a href="/b" target="frame">b</a><a href="/c">c</a>`, "0"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responses := analyzeDocument(t, "http://example.com/", "<html><body>"+test.body+"</body></html>")
+			if got := valueOf(t, responses, "unsafe target=_blank links"); got != test.links {
+				t.Errorf("unsafe target=_blank links = %q, want %q", got, test.links)
+			}
+		})
+	}
+}
+
+func TestFindAutoplayMedia(t *testing.T) {
+	tests := []struct {
+		name, body, media string
+	}{
+		{"muted", `<video src="a.mp4" autoplay muted playsinline></video>`, "1 (unmuted: 0)"},
+		{"unmuted", `<video src="a.mp4" autoplay></video><audio src="b.mp3" autoplay=""></audio><video src="c.mp4" autoplay muted></video>`, "3 (unmuted: 2)"},
+		{"no autoplay", `<video src="a.mp4" controls></video><audio src="b.mp3" muted></audio>`, "0 (unmuted: 0)"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responses := analyzeDocument(t, "http://example.com/", "<html><body>"+test.body+"</body></html>")
+			if got := valueOf(t, responses, "autoplay media"); got != test.media {
+				t.Errorf("autoplay media = %q, want %q", got, test.media)
+			}
+		})
+	}
+}
+
+func TestParseDevice(t *testing.T) {
+	tests := []struct {
+		device string
+		want   windowSize
+		ok     bool
+	}{
+		{"", deviceProfiles["desktop"], true},
+		{"mobile", windowSize{width: 375, height: 812}, true},
+		{" Tablet ", windowSize{width: 768, height: 1024}, true},
+		{"1280x720", windowSize{width: 1280, height: 720}, true},
+		{"1280X720", windowSize{width: 1280, height: 720}, true},
+		{"watch", windowSize{}, false},
+		{"0x720", windowSize{}, false},
+		{"1280x", windowSize{}, false},
+	}
+	for _, test := range tests {
+		got, err := parseDevice(test.device)
+		if (err == nil) != test.ok || (test.ok && got != test.want) {
+			t.Errorf("parseDevice(%q) = %+v, %v", test.device, got, err)
+		}
+	}
+}
+
+func TestAnalyzeDevice(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><head><title></title></head><body><script>document.title = "width " + window.innerWidth</script></body></html>`)
+	}))
+	defer server.Close()
+
+	message, err := json.Marshal(analyzeRequest{URL: server.URL, Device: "watch"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	responses := receiveUntil(t, string(message), func(response client.Response) bool {
+		return response.Status == client.StatusComplete || response.Status == client.StatusFailure
+	})
+	if last := responses[len(responses)-1]; last.Status != client.StatusFailure || last.Result != "unsupported device: watch" {
+		t.Errorf("last response = %v, want an unsupported device rejected", last)
+	}
+
+	if _, err := exec.LookPath("chromedriver"); err != nil {
+		t.Skip("chromedriver isn't on PATH")
+	}
+	if err := Setup(); err != nil {
+		t.Skipf("chrome unavailable: %v", err)
+	}
+	defer driver.Stop()
+
+	for device, want := range map[string]string{"mobile": "width 375", "1280x720": "width 1280"} {
+		responses = analyzeSite(t, analyzeRequest{URL: server.URL, Device: device})
+		if got := valueOf(t, responses, "title"); got != want {
+			t.Errorf("title rendered as %s = %q, want %q", device, got, want)
+		}
+	}
+}
+
+func TestFindRenderingMode(t *testing.T) {
+	tests := []struct {
+		doctype string
+		want    string
+	}{
+		{"<!DOCTYPE html>", "standards"},
+		{"<!doctype HTML>", "standards"},
+		{"", "quirks"},
+		{`<!DOCTYPE HTML PUBLIC "-//W3C//DTD HTML 4.01//EN" "http://www.w3.org/TR/html4/strict.dtd">`, "standards"},
+		{`<!DOCTYPE HTML PUBLIC "-//W3C//DTD HTML 4.01 Transitional//EN" "http://www.w3.org/TR/html4/loose.dtd">`, "almost-standards"},
+		{`<!DOCTYPE HTML PUBLIC "-//W3C//DTD HTML 4.01 Transitional//EN">`, "quirks"},
+		{`<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Transitional//EN" "http://www.w3.org/TR/xhtml1/DTD/xhtml1-transitional.dtd">`, "almost-standards"},
+		{`<!DOCTYPE HTML PUBLIC "-//W3C//DTD HTML 3.2 Final//EN">`, "quirks"},
+	}
+	for _, test := range tests {
+		responses := analyzeDocument(t, "http://example.com/", test.doctype+"<html><body></body></html>")
+		if got := valueOf(t, responses, "rendering mode"); got != test.want {
+			t.Errorf("rendering mode of %q = %q, want %q", test.doctype, got, test.want)
+		}
+	}
+}
+
+func TestFindHTTPEquivHeaders(t *testing.T) {
+	responses := analyzeDocument(t, "http://example.com/", `<html><head>
+		<meta http-equiv="Content-Type" content="text/html; charset=utf-8">
+		<meta http-equiv="refresh" content="30">
+		<meta http-equiv="X-UA-Compatible" content="IE=edge">
+		<meta http-equiv="Content-Security-Policy" content="default-src 'self'">
+		<meta name="description" content="not a header">
+	</head></html>`)
+	want := "content-type=text/html; charset=utf-8, refresh=30, x-ua-compatible=IE=edge, content-security-policy=default-src 'self'"
+	if got := valueOf(t, responses, "http-equiv headers"); got != want {
+		t.Errorf("http-equiv headers = %q, want %q", got, want)
+	}
+
+	responses = analyzeDocument(t, "http://example.com/", `<html><head><meta charset="utf-8"></head></html>`)
+	if got := valueOf(t, responses, "http-equiv headers"); got != "none" {
+		t.Errorf("http-equiv headers = %q, want none", got)
+	}
+}
+
+func TestResultLimits(t *testing.T) {
+	document := "<html><head><title>Title</title></head><body><h1>Heading</h1></body></html>"
+	tests := []struct {
+		name, key, value string
+		limited          func(results []client.Response) bool
+	}{
+		{"results", "ANALYZER_MAX_RESULTS", "5", func(results []client.Response) bool {
+			return len(results) == 5
+		}},
+		{"bytes", "ANALYZER_MAX_RESULT_BYTES", "200", func(results []client.Response) bool {
+			var size int
+			for _, result := range results {
+				size += len(result.Result)
+			}
+			return len(results) > 0 && size <= 200
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv(test.key, test.value)
+			responses := analyzeDocument(t, "http://example.com/", document)
+
+			var results []client.Response
+			var truncated int
+			for i, response := range responses {
+				switch {
+				case response.Result == "results truncated":
+					truncated++
+					if response.Status != client.StatusWarning || i != len(results) {
+						t.Errorf("truncation notice %v at %d, want a warning after the admitted results", response, i)
+					}
+				case response.Status == client.StatusSuccess || response.Status == client.StatusWarning || response.Status == client.StatusFailure:
+					results = append(results, response)
+				}
+			}
+			if truncated != 1 || !test.limited(results) {
+				t.Errorf("%d results, %d truncation notices, want the results cut at %s=%s", len(results), truncated, test.key, test.value)
+			}
+			if last := responses[len(responses)-1]; last.Status != client.StatusComplete {
+				t.Errorf("last response = %v, want the completion sent despite the limit", last)
+			}
+		})
+	}
+
+	responses := analyzeDocument(t, "http://example.com/", document)
+	if hasResult(responses, "results truncated") {
+		t.Error("results truncated within the default limits")
+	}
+}
+
+func TestFindImageSizes(t *testing.T) {
+	var mutex sync.Mutex
+	requests := map[string]int{}
+	images := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requests[r.Method+" "+r.URL.Path]++
+		mutex.Unlock()
+		sizes := map[string]int{"/hero.jpg": 3 * 1024 * 1024, "/logo.png": 200 * 1024}
+		size, ok := sizes[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(size))
+	}))
+	defer images.Close()
+	server, _ := servePages(t, map[string]string{"/": `<html><body>
+		<img src="` + images.URL + `/hero.jpg">
+		<img src="` + images.URL + `/logo.png"><img src="` + images.URL + `/logo.png">
+		<img src="` + images.URL + `/missing.png">
+		<img src="data:image/png;base64,iVBORw0KGgo=">
+	</body></html>`})
+
+	responses := analyzeSite(t, analyzeRequest{URL: server.URL, Static: true})
+	weight := "3.2 MB (largest: " + images.URL + "/hero.jpg, 3.0 MB), unknown size: 1"
+	if got := valueOf(t, responses, "total image weight"); got != weight {
+		t.Errorf("total image weight = %q, want %q", got, weight)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	want := map[string]int{"HEAD /hero.jpg": 1, "HEAD /logo.png": 1, "HEAD /missing.png": 1}
+	if !reflect.DeepEqual(requests, want) {
+		t.Errorf("requests = %v, want a HEAD request per unique image", requests)
+	}
+
+	server, _ = servePages(t, map[string]string{"/": `<html><body><img src="data:image/gif;base64,R0lGODlh"></body></html>`})
+	responses = analyzeSite(t, analyzeRequest{URL: server.URL, Static: true})
+	if got := valueOf(t, responses, "total image weight"); got != "0 B" {
+		t.Errorf("total image weight = %q, want data uris skipped", got)
+	}
+}
+
+func TestFindDataURIs(t *testing.T) {
+	document := `<html><head><style>@font-face { src: url(data:font/woff2;base64,` + strings.Repeat("AAAA", 256) + `) }</style></head><body>
+		<img src="data:image/png;base64,` + strings.Repeat("AAAA", 1000) + `">
+		<img src='data:image/svg+xml,%3Csvg%3E'>
+	</body></html>`
+	// 3000 and 768 bytes decoded from base64 and the 5 bytes of <svg>.
+	responses := analyzeDocument(t, "http://example.com/", document)
+	if got := valueOf(t, responses, "data URIs"); got != "3 (total 3.7 KB)" {
+		t.Errorf("data URIs = %q, want 3 (total 3.7 KB)", got)
+	}
+
+	responses = analyzeDocument(t, "http://example.com/", `<html><body><img src="/a.png"><p>data: none</p></body></html>`)
+	if got := valueOf(t, responses, "data URIs"); got != "none" {
+		t.Errorf("data URIs = %q, want none", got)
+	}
+}
+
+func TestAnalyzeStatic(t *testing.T) {
+	server, _ := servePages(t, map[string]string{"/": `<html><head><title>Static</title></head><body><h1>Served</h1>
+		<script>document.title = "Rendered"</script></body></html>`})
+
+	// without a driver, a page rendered with Chrome fails, so a static analysis never renders.
+	responses := analyzeSite(t, analyzeRequest{URL: server.URL, Static: true})
+	if got := valueOf(t, responses, "title"); got != "Static" {
+		t.Errorf("title = %q, want the title of the served html", got)
+	}
+	if got := valueOf(t, responses, "h1 count"); got != "1" {
+		t.Errorf("h1 count = %q, want the document checks run on the served html", got)
+	}
+	for _, response := range responses {
+		if response.Status == client.StatusProgress || response.Status == client.StatusFailure {
+			t.Errorf("response %v, want no rendering", response)
+		}
+	}
+	if last := responses[len(responses)-1]; last.Status != client.StatusComplete {
+		t.Errorf("last response = %v, want the analysis completed", last)
+	}
+}
+
+// respondTo returns the responses run sends with a responder for a client
+// connected over a websocket.
+func respondTo(t *testing.T, run func(responder *responder)) []client.Response {
+	t.Helper()
+	server := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		responder := newResponder(ws, "en")
+		run(responder)
+		responder.respond("done", statusComplete)
+	}))
+	defer server.Close()
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/", "", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	return readUntil(t, ws, func(response client.Response) bool {
+		return response.Status == client.StatusComplete
+	})
+}
+
+func TestFindRenderDiff(t *testing.T) {
+	const served = `<html><head><title>App</title></head><body>
+		<h1>Shop</h1><a href="/home">home</a><div id="root"></div>
+		<script>inject()</script></body></html>`
+	tests := []struct {
+		name, rendered, changes string
+	}{
+		{"injected", `<html><head><title>App - Products</title></head><body>
+			<h1>Shop</h1><a href="/home">home</a><div id="root"><h2>Products</h2><a href="/products/1">one</a><a href="https://example.com/products/2">two</a></div>
+			</body></html>`, `2 links added, 1 headings added, title changed from "App" to "App - Products"`},
+		{"unchanged", served, "none"},
+		// a relative and an absolute link to the same url are the same link.
+		{"resolved links", `<html><head><title>App</title></head><body>
+			<h1>Shop</h1><a href="https://example.com/home">home</a></body></html>`, "none"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responses := respondTo(t, func(responder *responder) {
+				static, err := getDocument(served, "")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				rendered, err := getDocument(test.rendered, "")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				analyzer := NewAnalyzer(responder, "https://example.com/", test.rendered, rendered)
+				analyzer.staticDocument = static
+				analyzer.findRenderDiff()
+			})
+			if got := valueOf(t, responses, "javascript changes"); got != test.changes {
+				t.Errorf("javascript changes = %q, want %q", got, test.changes)
+			}
+		})
+	}
+
+	// without the served html, as for supplied html, there is nothing to compare.
+	responses := analyzeDocument(t, "https://example.com/", served)
+	if hasLabel(responses, "javascript changes") {
+		t.Error("render diff reported without a static document")
+	}
+}
+
+func TestChromeOptions(t *testing.T) {
+	options := chromeOptions()
+	if _, ok := options["binary"]; ok {
+		t.Errorf("options = %v, want the default Chrome binary", options)
+	}
+	if args, _ := options["args"].([]string); len(args) == 0 || args[0] != "--headless" {
+		t.Errorf("args = %v, want Chrome started headless", options["args"])
+	}
+
+	t.Setenv("ANALYZER_CHROME_BINARY", "/opt/chrome/chrome")
+	if got := chromeOptions()["binary"]; got != "/opt/chrome/chrome" {
+		t.Errorf("binary = %v, want the configured Chrome binary", got)
+	}
+}
+
+func TestChromeDriverPath(t *testing.T) {
+	driverPath := filepath.Join(t.TempDir(), "missing-chromedriver")
+	t.Setenv("ANALYZER_CHROMEDRIVER_PATH", driverPath)
+
+	// the configured chromedriver is started rather than the one on PATH.
+	err := Setup()
+	if err == nil {
+		driver.Stop()
+		t.Fatal("started a chromedriver which doesn't exist")
+	}
+	if !strings.Contains(err.Error(), driverPath) {
+		t.Errorf("Setup() = %v, want the configured chromedriver started", err)
+	}
+}
+
+func TestFindEmptyElements(t *testing.T) {
+	tests := []struct {
+		name, body, empty string
+	}{
+		{"empty", `<h2></h2><h2> </h2><a href="/x"></a><li></li><p><span></span></p><h1>Title</h1>`, "h2(2), a(1), li(1), p(1)"},
+		{"content", `<h2>Heading</h2><a href="/x"><img src="x.png" alt="x"></a><a href="/y" aria-label="Close"></a>
+			<li><input type="checkbox"></li><p>text</p><a name="anchor"></a>`, "none"},
+		{"scripts only", `<p><script>var text = "not content"</script></p>`, "p(1)"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responses := analyzeDocument(t, "http://example.com/", "<html><body>"+test.body+"</body></html>")
+			if got := valueOf(t, responses, "empty elements"); got != test.empty {
+				t.Errorf("empty elements = %q, want %q", got, test.empty)
+			}
+		})
+	}
+}
+
+func TestFindLinksUnique(t *testing.T) {
+	responses := analyzeDocument(t, "https://example.com/", `<html><body>
+		<a href="/about">About</a><a href="/about">About us</a><a href="/about#team">Team</a>
+		<a href="https://external.example/">External</a><a href="https://external.example/">External again</a>
+		<a name="anchor">no href</a>
+	</body></html>`)
+	for label, want := range map[string]string{
+		"total links":         "5, unique : 3",
+		"internal link count": "2",
+		"external link count": "1",
+	} {
+		if got := valueOf(t, responses, label); got != want {
+			t.Errorf("%s = %q, want %q", label, got, want)
+		}
+	}
+}
+
+func TestFindAppMetadata(t *testing.T) {
+	responses := analyzeDocument(t, "http://example.com/", `<html><head>
+		<meta name="msapplication-TileColor" content="#2b5797">
+		<meta name="application-name" content=" Example ">
+		<meta name="apple-mobile-web-app-title" content="Example App">
+		<meta name="description" content="not app metadata">
+	</head></html>`)
+	want := "application-name=Example, apple-mobile-web-app-title=Example App, msapplication-tilecolor=#2b5797"
+	if got := valueOf(t, responses, "app metadata"); got != want {
+		t.Errorf("app metadata = %q, want %q", got, want)
+	}
+
+	responses = analyzeDocument(t, "http://example.com/", `<html><head><meta name="description" content="page"></head></html>`)
+	if got := valueOf(t, responses, "app metadata"); got != "not found" {
+		t.Errorf("app metadata = %q, want not found", got)
+	}
+}
+
+// crawlSite serves a home page linking to six pages, a missing page, a page
+// disallowed by robots.txt and an external site. It records the pages requested
+// and the most requested at the same time.
+func crawlSite(t *testing.T) (server *httptest.Server, requested func() (pages []string, concurrent int)) {
+	t.Helper()
+	var mutex sync.Mutex
+	var pages []string
+	var inFlight, maxInFlight int
+
+	home := `<html><body>
+		<a href="/p1">1</a><a href="/p2">2</a><a href="/p3">3</a><a href="/p1#top">1 again</a>
+		<a href="/private/page">private</a><a href="/p4">4</a><a href="/p5">5</a><a href="/p6">6</a>
+		<a href="/missing">missing</a><a href="http://external.example/">external</a>
+	</body></html>`
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, home)
+			return
+		case r.URL.Path == "/robots.txt":
+			fmt.Fprint(w, "User-agent: *\nDisallow: /private\n")
+			return
+		case !strings.HasPrefix(r.URL.Path, "/p") && r.URL.Path != "/missing":
+			http.NotFound(w, r)
+			return
+		}
+
+		mutex.Lock()
+		pages = append(pages, r.URL.Path)
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mutex.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mutex.Lock()
+		inFlight--
+		mutex.Unlock()
+
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() ([]string, int) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		sort.Strings(pages)
+		return pages, maxInFlight
+	}
+}
+
+func TestCrawl(t *testing.T) {
+	t.Setenv("ANALYZER_CRAWL_CONCURRENCY", "2")
+	server, requested := crawlSite(t)
+
+	responses := analyzeSite(t, analyzeRequest{URL: server.URL, Static: true, Crawl: true})
+	if got := valueOf(t, responses, "pages crawled"); got != "7 (disallowed by robots.txt: 1)" {
+		t.Errorf("pages crawled = %q", got)
+	}
+	if got := valueOf(t, responses, "broken internal links"); got != "1 ("+server.URL+"/missing)" {
+		t.Errorf("broken internal links = %q", got)
+	}
+	pages, concurrent := requested()
+	if want := []string{"/missing", "/p1", "/p2", "/p3", "/p4", "/p5", "/p6"}; !reflect.DeepEqual(pages, want) {
+		t.Errorf("crawled %v, want %v", pages, want)
+	}
+	if concurrent > 2 {
+		t.Errorf("crawled %d pages at the same time, want at most 2", concurrent)
+	}
+}
+
+func TestCrawlLimit(t *testing.T) {
+	t.Setenv("ANALYZER_CRAWL_MAX_PAGES", "3")
+	server, requested := crawlSite(t)
+
+	responses := analyzeSite(t, analyzeRequest{URL: server.URL, Static: true, Crawl: true})
+	if got := valueOf(t, responses, "pages crawled"); got != "3 (disallowed by robots.txt: 0)" {
+		t.Errorf("pages crawled = %q", got)
+	}
+	if pages, _ := requested(); !reflect.DeepEqual(pages, []string{"/p1", "/p2", "/p3"}) {
+		t.Errorf("crawled %v, want the first three pages", pages)
+	}
+}
+
+func TestCrawlNotRequested(t *testing.T) {
+	server, requested := crawlSite(t)
+	responses := analyzeSite(t, analyzeRequest{URL: server.URL, Static: true})
+	if hasLabel(responses, "pages crawled") {
+		t.Error("crawled although the request didn't ask for it")
+	}
+	if pages, _ := requested(); len(pages) != 0 {
+		t.Errorf("crawled %v", pages)
+	}
+}
+
+func TestRobotsDisallowed(t *testing.T) {
+	robots := `
+User-agent: googlebot
+Disallow: /google-only
+
+User-agent: *
+User-agent: otherbot
+Disallow: /private # comment
+Allow: /private/public
+Disallow:
+
+User-agent: thirdbot
+Disallow: /third
+`
+	want := []string{"/private"}
+	if got := robotsDisallowed(robots); !reflect.DeepEqual(got, want) {
+		t.Errorf("robotsDisallowed = %v, want %v", got, want)
+	}
+	if got := robotsDisallowed(""); len(got) != 0 {
+		t.Errorf("robotsDisallowed of an empty robots.txt = %v", got)
+	}
+}
+
+func TestFindAccessKeys(t *testing.T) {
+	tests := []struct {
+		name, body, keys, conflicts string
+	}{
+		{"unique", `<a href="/" accesskey="h">home</a><a href="/search" accesskey="s">search</a>`, "2", ""},
+		{"conflicting", `<a href="/" accesskey="S">home</a><button accesskey="s">save</button><input accesskey="x s"><a href="/h" accesskey="h">h</a>`, "5", "s(3)"},
+		{"none", `<a href="/">home</a>`, "0", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responses := analyzeDocument(t, "http://example.com/", "<html><body>"+test.body+"</body></html>")
+			if got := valueOf(t, responses, "accesskeys"); got != test.keys {
+				t.Errorf("accesskeys = %q, want %q", got, test.keys)
+			}
+			var conflicts string
+			if hasLabel(responses, "accesskey conflicts") {
+				conflicts = valueOf(t, responses, "accesskey conflicts")
+			}
+			if conflicts != test.conflicts {
+				t.Errorf("accesskey conflicts = %q, want %q", conflicts, test.conflicts)
+			}
+		})
+	}
+}
+
+func TestFindInlineScriptSize(t *testing.T) {
+	large := strings.Repeat("a", 60*1024)
+	tests := []struct {
+		name, body, size string
+		status           client.Status
+	}{
+		{"small", `<script>var a = 1;</script><script src="/big.js"></script>`, "10 B", client.StatusSuccess},
+		{"large", `<script>` + large[:30*1024] + `</script><script type="module">` + large[:30*1024] + `</script>`, "60.0 KB, over 50.0 KB", client.StatusWarning},
+		// data blocks aren't executed.
+		{"data blocks", `<script type="application/ld+json">` + large + `</script><script type="text/template">` + large + `</script>`, "0 B", client.StatusSuccess},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responses := analyzeDocument(t, "http://example.com/", "<html><body>"+test.body+"</body></html>")
+			if got := valueOf(t, responses, "inline script size"); got != test.size {
+				t.Errorf("inline script size = %q, want %q", got, test.size)
+			}
+			for _, response := range responses {
+				if response.Label == "inline script size" && response.Status != test.status {
+					t.Errorf("inline script size status = %v, want %v", response.Status, test.status)
+				}
+			}
+		})
+	}
+}
+
+func TestFindFavicon(t *testing.T) {
+	icons := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/icon.png":
+			w.Header().Set("Content-Type", "image/png")
+		case "/get-only.ico":
+			if r.Method != http.MethodGet {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.Header().Set("Content-Type", "image/x-icon")
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer icons.Close()
+
+	tests := []struct {
+		name, head, favicon string
+		status              client.Status
+	}{
+		{"reachable", `<link rel="shortcut icon" href="` + icons.URL + `/icon.png">`, icons.URL + "/icon.png (status 200, image/png)", client.StatusSuccess},
+		{"head not allowed", `<link rel="icon" href="` + icons.URL + `/get-only.ico">`, icons.URL + "/get-only.ico (status 200, image/x-icon)", client.StatusSuccess},
+		{"missing", `<link rel="icon" href="` + icons.URL + `/missing.ico">`, icons.URL + "/missing.ico (status 404, text/html)", client.StatusWarning},
+		{"inline", `<link rel="icon" href="data:image/png;base64,iVBORw0KGgo=">`, "inline data URI", client.StatusSuccess},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, _ := servePages(t, map[string]string{"/": "<html><head>" + test.head + "</head></html>"})
+			responses := analyzeSite(t, analyzeRequest{URL: server.URL, Static: true})
+			for _, response := range responses {
+				if response.Label != "favicon" {
+					continue
+				}
+				if got := html.UnescapeString(strings.SplitN(response.Result, " : ", 2)[1]); got != test.favicon || response.Status != test.status {
+					t.Errorf("favicon = %q, %v, want %q, %v", got, response.Status, test.favicon, test.status)
+				}
+			}
+			if !hasLabel(responses, "favicon") {
+				t.Errorf("responses = %v, want a favicon result", responses)
+			}
+		})
+	}
+}
+
+func TestFindFaviconDefault(t *testing.T) {
+	server, headers := servePages(t, map[string]string{"/": "<html><head></head></html>"})
+	responses := analyzeSite(t, analyzeRequest{URL: server.URL, Static: true})
+	if got := valueOf(t, responses, "favicon"); got != server.URL+"/favicon.ico (status 404, text/plain; charset=utf-8)" {
+		t.Errorf("favicon = %q, want the default favicon requested", got)
+	}
+	if headers("/favicon.ico") == nil {
+		t.Error("/favicon.ico wasn't requested")
+	}
+}
+
+func TestAnalyzeDoesNotSendCredentialsToOtherHosts(t *testing.T) {
+	var authorization string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+	}))
+	defer other.Close()
+	server, headers := servePages(t, map[string]string{"/": `<html><head><link rel="icon" href="` + other.URL + `/icon.png"></head></html>`})
+
+	analyzeSite(t, analyzeRequest{URL: server.URL, Static: true, Token: "token"})
+	if authorization != "" {
+		t.Errorf("favicon of another host requested with Authorization %q", authorization)
+	}
+	if got := headers("/").Get("Authorization"); got != "Bearer token" {
+		t.Errorf("Authorization of the page = %q, want the token", got)
+	}
+}
+
+func TestFindSemanticStructure(t *testing.T) {
+	tests := []struct {
+		name, body, elements string
+		status               client.Status
+	}{
+		{"semantic", `<header><nav><a href="/">home</a></nav></header><main><article><section></section><section></section>
+			<figure></figure></article><aside></aside></main><footer></footer>`,
+			"section(2), article(1), aside(1), figure(1), footer(1), header(1), main(1), nav(1)", client.StatusSuccess},
+		{"div soup", `<div class="header"><div class="nav"></div></div><div class="content"></div>`, "none, 3 divs", client.StatusWarning},
+		{"empty", `<p>text</p>`, "none", client.StatusSuccess},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responses := analyzeDocument(t, "http://example.com/", "<html><body>"+test.body+"</body></html>")
+			if got := valueOf(t, responses, "semantic elements"); got != test.elements {
+				t.Errorf("semantic elements = %q, want %q", got, test.elements)
+			}
+			for _, response := range responses {
+				if response.Label == "semantic elements" && response.Status != test.status {
+					t.Errorf("semantic elements status = %v, want %v", response.Status, test.status)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckDomain(t *testing.T) {
+	tests := []struct {
+		allowed, denied string
+		url             string
+		ok              bool
+	}{
+		{url: "http://anything.example", ok: true},
+		{allowed: "example.com", url: "http://example.com/page", ok: true},
+		{allowed: "example.com", url: "http://other.com/", ok: false},
+		{allowed: "example.com", url: "http://www.example.com/", ok: false},
+		{allowed: "*.example.com", url: "http://www.example.com/", ok: true},
+		{allowed: "*.example.com", url: "http://a.b.example.com/", ok: true},
+		{allowed: "example.com, *.example.com", url: "HTTP://EXAMPLE.COM/", ok: true},
+		{denied: "internal.example.com", url: "http://internal.example.com/", ok: false},
+		{denied: "internal.example.com", url: "http://internal.example.com./", ok: false},
+		{denied: "internal.example.com.", url: "http://internal.example.com/", ok: false},
+		{denied: "internal.example.com", url: "http://internal.example.com:8080/", ok: false},
+		{denied: "internal.example.com", url: "http://public.example.com/", ok: true},
+		{denied: "*.internal", url: "http://db.internal/", ok: false},
+		{allowed: "*.example.com", denied: "secret.example.com", url: "http://secret.example.com/", ok: false},
+		{allowed: "*.example.com", denied: "secret.example.com", url: "http://www.example.com/", ok: true},
+		{allowed: "example.com", url: "", ok: true},
+		{allowed: "example.com", url: "file:///tmp/page.html", ok: true},
+	}
+
+	for _, test := range tests {
+		t.Setenv("ANALYZER_ALLOWED_DOMAINS", test.allowed)
+		t.Setenv("ANALYZER_DENIED_DOMAINS", test.denied)
+		if err := checkDomain(test.url); (err == nil) != test.ok {
+			t.Errorf("checkDomain(%q) with allowed %q, denied %q = %v, want ok %t", test.url, test.allowed, test.denied, err, test.ok)
+		}
+	}
+}
+
+func TestWebsocketHandlerRejectsDeniedDomains(t *testing.T) {
+	t.Setenv("ANALYZER_DENIED_DOMAINS", "denied.example")
+	responses := analyzeMessage(t, "http://denied.example/")
+	if len(responses) != 1 || responses[0].Status != client.StatusFailure || !strings.Contains(responses[0].Result, "domain not allowed") {
+		t.Errorf("responses = %v, want a domain not allowed failure", responses)
+	}
+}
+
+func TestPreflightDoesNotRedirectToDeniedDomains(t *testing.T) {
+	t.Setenv("ANALYZER_DENIED_DOMAINS", "denied.example")
+	server := httptest.NewServer(http.RedirectHandler("http://denied.example/", http.StatusFound))
+	defer server.Close()
+
+	_, _, err := preflight(analyzeRequest{URL: server.URL})
+	if err == nil || !strings.Contains(err.Error(), "domain not allowed") {
+		t.Errorf("preflight error = %v, want domain not allowed", err)
+	}
+}
+
+func TestFindTrackingPixels(t *testing.T) {
+	tests := []struct {
+		name, body, pixels string
+	}{
+		{"external pixels", `<img src="https://www.facebook.com/tr?id=1" width="1" height="1">
+			<img src="https://www.google-analytics.com/collect" width="1px" height="1px">
+			<img src="https://connect.facebook.net/p.gif" width="0" height="0">`,
+			"3 (facebook.com, facebook.net, google-analytics.com)"},
+		{"internal pixel", `<img src="/spacer.gif" width="1" height="1">`, "0"},
+		{"normal images", `<img src="https://cdn.example.org/photo.jpg" width="640" height="480">
+			<img src="https://cdn.example.org/banner.jpg" width="1">
+			<img src="https://cdn.example.org/logo.png">`, "0"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responses := analyzeDocument(t, "http://example.com/", "<html><body>"+test.body+"</body></html>")
+			if got := valueOf(t, responses, "tracking pixels"); got != test.pixels {
+				t.Errorf("tracking pixels = %q, want %q", got, test.pixels)
+			}
+		})
+	}
+}
+
+func TestFindDisabledFormControls(t *testing.T) {
+	tests := []struct {
+		name, body, controls string
+	}{
+		{"mixed", `<form>
+			<input name="a" disabled><input name="b" readonly><textarea readonly></textarea>
+			<select disabled></select><button disabled>send</button>
+			<input type="hidden" name="token" disabled><input name="c">
+			<fieldset disabled><input name="d"><select></select></fieldset>
+		</form>`, "5, readonly : 2"},
+		{"normal", `<form><input name="a"><textarea></textarea><button>send</button></form>`, "0, readonly : 0"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responses := analyzeDocument(t, "http://example.com/", "<html><body>"+test.body+"</body></html>")
+			if got := valueOf(t, responses, "disabled form controls"); got != test.controls {
+				t.Errorf("disabled form controls = %q, want %q", got, test.controls)
+			}
+		})
+	}
+}
+
+func TestFindXUACompatible(t *testing.T) {
+	tests := []struct {
+		name, head, value string
+		status            client.Status
+	}{
+		{"ie edge", `<meta http-equiv="X-UA-Compatible" content="IE=edge">`, "IE=edge", client.StatusWarning},
+		{"lower case", `<meta http-equiv="x-ua-compatible" content="ie=11">`, "ie=11", client.StatusWarning},
+		{"none", `<meta charset="utf-8">`, "not found", client.StatusSuccess},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responses := analyzeDocument(t, "http://example.com/", "<html><head>"+test.head+"</head><body></body></html>")
+			if got := valueOf(t, responses, "x-ua-compatible"); got != test.value {
+				t.Errorf("x-ua-compatible = %q, want %q", got, test.value)
+			}
+			for _, response := range responses {
+				if response.Label == "x-ua-compatible" && response.Status != test.status {
+					t.Errorf("x-ua-compatible status = %v, want %v", response.Status, test.status)
+				}
+			}
+		})
+	}
+}
+
+func TestAnalyzerChecks(t *testing.T) {
+	names := map[string]bool{}
+	for _, check := range analyzerChecks {
+		if names[check.name] {
+			t.Errorf("check %s registered twice", check.name)
+		}
+		names[check.name] = true
+	}
+}
+
+func TestRerun(t *testing.T) {
+	t.Setenv("ANALYZER_RERUN_CACHE_SIZE", "5")
+	responses := analyzeDocument(t, "http://example.com/", "<html><head><title>Rerun</title></head><body><h1>a</h1></body></html>")
+	id := responses[0].ID
+
+	message, err := json.Marshal(analyzeRequest{Type: requestTypeRerun, ID: id, Checks: []string{"findTitle", "findNothing", "findSitemap"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	responses = receiveUntil(t, string(message), func(response client.Response) bool {
+		return response.Status == client.StatusComplete
+	})
+	if got := valueOf(t, responses, "title"); got != "Rerun" {
+		t.Errorf("title = %q, want the title of the cached html", got)
+	}
+	if hasLabel(responses, "h1 count") {
+		t.Error("rerun ran a check it wasn't asked for")
+	}
+	for _, want := range []string{"unknown check: findNothing", "check does not apply to the analysis: findSitemap"} {
+		if !hasResult(responses, want) {
+			t.Errorf("responses = %v, want %q", responses, want)
+		}
+	}
+}
+
+func TestRerunIsOptIn(t *testing.T) {
+	responses := analyzeDocument(t, "http://example.com/", "<html><head><title>Rerun</title></head></html>")
+	id := responses[0].ID
+	if _, ok := cachedAnalysisOf(id); ok {
+		t.Fatal("analysis cached without ANALYZER_RERUN_CACHE_SIZE")
+	}
+
+	message, err := json.Marshal(analyzeRequest{Type: requestTypeRerun, ID: id, Checks: []string{"findTitle"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	responses = receiveUntil(t, string(message), func(response client.Response) bool {
+		return response.Status == client.StatusFailure
+	})
+	if !hasResult(responses, "analysis not found or expired: "+id) {
+		t.Errorf("responses = %v, want a not found failure", responses)
+	}
+}
+
+func TestCacheOmitsCredentials(t *testing.T) {
+	t.Setenv("ANALYZER_RERUN_CACHE_SIZE", "5")
+	document, err := goquery.NewDocumentFromReader(strings.NewReader("<html></html>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	analyzer := NewAnalyzer(&responder{id: newAnalysisID()}, "http://example.com/", "<html></html>", document)
+	analyzer.origin = analyzeRequest{URL: "http://example.com/", Username: "user", Password: "secret", Token: "token", Referer: "http://example.com/from"}
+	analyzer.cache("")
+
+	cached, ok := cachedAnalysisOf(analyzer.id)
+	if !ok {
+		t.Fatal("analysis not cached")
+	}
+	if origin := cached.origin; origin.Username != "" || origin.Password != "" || origin.Token != "" {
+		t.Errorf("cached origin has credentials: %+v", origin)
+	}
+	if cached.origin.Referer != "http://example.com/from" {
+		t.Errorf("cached referer = %q, want the referer of the analysis", cached.origin.Referer)
+	}
+}
+
+func TestFindSVGs(t *testing.T) {
+	tests := []struct {
+		name, body, svgs string
+	}{
+		{"inline and external", `<svg><svg></svg><use href="/sprite.svg#icon"></use></svg><svg></svg>
+			<img src="/logo.svg"><img src="/photo.png"><object data="/chart.SVG?v=2"></object><embed src="/map.svg">`,
+			"2, external svgs : 4"},
+		{"none", `<img src="/photo.png">`, "0, external svgs : 0"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responses := analyzeDocument(t, "http://example.com/", "<html><body>"+test.body+"</body></html>")
+			if got := valueOf(t, responses, "inline svgs"); got != test.svgs {
+				t.Errorf("inline svgs = %q, want %q", got, test.svgs)
+			}
+		})
+	}
+}
+
+func TestFindConsentBanner(t *testing.T) {
+	tests := []struct {
+		name, body, banner string
+	}{
+		{"onetrust", `<script src="https://cdn.cookielaw.org/scripttemplates/otSDKStub.js"></script>
+			<script src="https://consent.cookiebot.com/uc.js"></script>`, "Cookiebot, OneTrust"},
+		{"banner element", `<div id="cookie-notice">we use cookies</div>`, "likely present"},
+		{"none", `<div class="content"><script src="/app.js"></script></div>`, "not found"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responses := analyzeDocument(t, "http://example.com/", "<html><body>"+test.body+"</body></html>")
+			if got := valueOf(t, responses, "consent banner"); got != test.banner {
+				t.Errorf("consent banner = %q, want %q", got, test.banner)
+			}
+		})
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var durations []time.Duration
+	for i := 1; i <= 20; i++ {
+		durations = append(durations, time.Duration(i)*time.Second)
+	}
+
+	tests := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{0, time.Second},
+		{50, 10 * time.Second},
+		{95, 19 * time.Second},
+		{100, 20 * time.Second},
+	}
+	for _, test := range tests {
+		if got := percentile(durations, test.p); got != test.want {
+			t.Errorf("percentile(%v) = %s, want %s", test.p, got, test.want)
+		}
+	}
+	if got := percentile([]time.Duration{time.Second}, 95); got != time.Second {
+		t.Errorf("percentile of a single duration = %s", got)
+	}
+}
+
+func TestParseAnalyzeRequestBatchLimit(t *testing.T) {
+	t.Setenv("ANALYZER_MAX_BATCH_URLS", "1")
+	if _, err := parseAnalyzeRequest(`{"type": "batch", "urls": ["http://a.example", "http://b.example"]}`); err == nil {
+		t.Error("batch over the limit accepted")
+	}
+}
+
+func TestAnalyzeBatch(t *testing.T) {
+	server, _ := servePages(t, map[string]string{
+		"/a": "<html><head><title>A</title></head></html>",
+		"/b": "<html><head><title>B</title></head></html>",
+	})
+	message, err := json.Marshal(analyzeRequest{Type: requestTypeBatch, URLs: []string{server.URL + "/a", server.URL + "/b", server.URL + "/missing"}, Static: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	responses := receiveUntil(t, string(message), func(response client.Response) bool {
+		return response.Status == client.StatusComplete && strings.HasPrefix(response.Result, "batch completed")
+	})
+
+	var titles []string
+	for _, response := range responses {
+		if response.Label == "title" {
+			titles = append(titles, strings.TrimPrefix(response.Result, "title : "))
+		}
+	}
+	if !reflect.DeepEqual(titles, []string{"A", "B"}) {
+		t.Errorf("titles = %v, want each page analyzed in order", titles)
+	}
+	summary := responses[len(responses)-1].Result
+	if !regexp.MustCompile(`^batch completed : 2 of 3 urls analyzed, min \S+, median \S+, p95 \S+, max \S+$`).MatchString(summary) {
+		t.Errorf("batch summary = %q", summary)
+	}
+}
+
+func TestFindInputAutocomplete(t *testing.T) {
+	tests := []struct {
+		name, body, issues string
+	}{
+		{"good", `<input name="email" type="email" autocomplete="email"><input type="password" autocomplete="current-password">
+			<input name="query">`, "none"},
+		{"missing", `<input name="email" type="email"><input type="tel"><input id="first-name"><input name="query">`,
+			"3 inputs missing autocomplete, 0 password fields with autocomplete off"},
+		{"password off", `<input type="password" autocomplete="off">`, "0 inputs missing autocomplete, 1 password fields with autocomplete off"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responses := analyzeDocument(t, "http://example.com/", "<html><body><form>"+test.body+"</form></body></html>")
+			if got := valueOf(t, responses, "autocomplete issues"); got != test.issues {
+				t.Errorf("autocomplete issues = %q, want %q", got, test.issues)
+			}
+		})
+	}
+}
+
+func TestFailFast(t *testing.T) {
+	responses := respondTo(t, func(responder *responder) {
+		document, err := goquery.NewDocumentFromReader(strings.NewReader("<html></html>"))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		analyzer := NewAnalyzer(responder, "http://example.com/", "", document)
+		analyzer.failFast = true
+		analyzer.startTime = time.Now()
+
+		failed := make(chan struct{})
+		var once sync.Once
+		for _, name := range []string{"first", "second"} {
+			name := name
+			analyzer.concur(analyzerCheck{name: name, run: func(a *Analyzer) {
+				a.failure(name, "broken links : timeout")
+				once.Do(func() { close(failed) })
+			}})
+		}
+		analyzer.concur(analyzerCheck{name: "slow", run: func(a *Analyzer) {
+			<-failed
+			a.success("slow : done")
+		}})
+		analyzer.Wait()
+		analyzer.concur(analyzerCheck{name: "late", run: func(a *Analyzer) {
+			a.success("late : done")
+		}})
+		analyzer.Complete()
+	})
+
+	var failures int
+	for _, response := range responses {
+		if response.Status == client.StatusFailure {
+			failures++
+		}
+	}
+	if failures != 1 {
+		t.Errorf("%d failures, want only the one which stopped the analysis: %v", failures, responses)
+	}
+	if hasLabel(responses, "slow") || hasLabel(responses, "late") {
+		t.Errorf("responses = %v, want no results after the analysis stopped", responses)
+	}
+	last := responses[len(responses)-1]
+	if last.Label != "analysis stopped" || last.Status != client.StatusComplete {
+		t.Errorf("last response = %+v, want the analysis completed as stopped", last)
+	}
+}
+
+func TestFindLongClassLists(t *testing.T) {
+	classes := func(n int) string {
+		var names []string
+		for i := 0; i < n; i++ {
+			names = append(names, fmt.Sprintf("c%d", i))
+		}
+		return strings.Join(names, " ")
+	}
+	document := fmt.Sprintf(`<html><body><div class="%s"></div><div class="%s"></div><p class="%s"></p></body></html>`,
+		classes(21), classes(20), classes(3))
+
+	responses := analyzeDocument(t, "http://example.com/", document)
+	if got := valueOf(t, responses, "elements with >20 classes"); got != "1" {
+		t.Errorf("elements with >20 classes = %q, want 1", got)
+	}
+
+	t.Setenv("ANALYZER_MAX_CLASSES", "2")
+	responses = analyzeDocument(t, "http://example.com/", document)
+	if got := valueOf(t, responses, "elements with >2 classes"); got != "3" {
+		t.Errorf("elements with >2 classes = %q, want 3", got)
+	}
+}
+
+func TestFindRSSFeeds(t *testing.T) {
+	tests := []struct {
+		name, head, feeds string
+	}{
+		{"rss and atom", `<link rel="alternate" type="application/rss+xml" href="/feed.xml">
+			<link rel="Alternate" type="application/atom+xml" href="https://blog.example.com/atom.xml">
+			<link rel="alternate" hreflang="de" type="text/html" href="/de/">`,
+			"http://example.com/feed.xml, https://blog.example.com/atom.xml"},
+		{"none", `<link rel="stylesheet" type="text/css" href="/style.css">`, "none"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responses := analyzeDocument(t, "http://example.com/", "<html><head>"+test.head+"</head><body></body></html>")
+			if got := valueOf(t, responses, "feeds"); got != test.feeds {
+				t.Errorf("feeds = %q, want %q", got, test.feeds)
+			}
+		})
+	}
+}
+
+func TestFindDoNotTrack(t *testing.T) {
+	tests := []struct {
+		name, body, checked string
+	}{
+		{"checked", `<script>var a = 1;</script><script>if (navigator.doNotTrack !== "1") { loadAnalytics(); }</script>`, "true"},
+		{"external script", `<script src="/dnt.js"></script><script>loadAnalytics();</script>`, "false"},
+		{"none", `<p>navigator.doNotTrack</p>`, "false"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responses := analyzeDocument(t, "http://example.com/", "<html><body>"+test.body+"</body></html>")
+			if got := valueOf(t, responses, "do not track checked"); got != test.checked {
+				t.Errorf("do not track checked = %q, want %q", got, test.checked)
+			}
+		})
+	}
+}
+
+func TestGuessLanguage(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"The quick brown fox jumps over the lazy dog and it is not the end of the story for you", "en"},
+		{"Le chat est sur la table et il ne veut pas descendre pour manger avec les enfants dans la cuisine", "fr"},
+		{"Der Hund ist nicht auf dem Tisch und er will auch nicht mit den Kindern in die Küche gehen", "de"},
+		{"El perro no está en la mesa y no quiere ir a la cocina con los niños para comer", "es"},
+		{"Too short to tell", ""},
+		{"lorem ipsum dolor sit amet consectetur adipiscing elit sed do eiusmod tempor incididunt", ""},
+	}
+
+	for _, test := range tests {
+		if got := guessLanguage(test.text); got != test.want {
+			t.Errorf("guessLanguage(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestFindMissingLangOnContent(t *testing.T) {
+	english := "The quick brown fox jumps over the lazy dog and it is not the end of the story for you"
+	french := "Le chat est sur la table et il ne veut pas descendre pour manger avec les enfants dans la cuisine"
+	tests := []struct {
+		name, document, untagged string
+	}{
+		{"mixed", `<html lang="en"><body><p>` + english + `</p><p>` + french + `</p><ul><li>` + french + `</li></ul></body></html>`, "fr(2)"},
+		{"tagged", `<html lang="en-GB"><body><p>` + english + `</p><blockquote lang="fr"><p>` + french + `</p></blockquote></body></html>`, "none"},
+		{"no lang", `<html><body><p>` + french + `</p></body></html>`, "none"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responses := analyzeDocument(t, "http://example.com/", test.document)
+			if got := valueOf(t, responses, "possible untagged foreign-language content"); got != test.untagged {
+				t.Errorf("possible untagged foreign-language content = %q, want %q", got, test.untagged)
+			}
+		})
+	}
+}
+
+func TestFindDecorativeAndMissingAlt(t *testing.T) {
+	tests := []struct {
+		name, body, images string
+	}{
+		{"mixed", `<img src="/divider.png" alt=""><img src="/spacer.png" alt=""><img src="/chart.png"><img src="/logo.png" alt="Logo">`,
+			"2, images missing alt : 1"},
+		{"all described", `<img src="/logo.png" alt="Logo">`, "0, images missing alt : 0"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responses := analyzeDocument(t, "http://example.com/", "<html><body>"+test.body+"</body></html>")
+			if got := valueOf(t, responses, "decorative images (empty alt)"); got != test.images {
+				t.Errorf("decorative images (empty alt) = %q, want %q", got, test.images)
+			}
+		})
+	}
+}
+
+func TestFindViewportUnits(t *testing.T) {
+	tests := []struct {
+		name, body, styles string
+	}{
+		{"viewport units", `<div style="height: 100vh"></div><div style="width:50.5VW"></div><div style="min-height: 100dvh"></div>
+			<div style="font-size: 2vmin"></div><div style="height: 100px"></div>`, "4"},
+		{"none", `<div style="height: 100px; width: 50%"></div><div class="vh"></div>`, "0"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responses := analyzeDocument(t, "http://example.com/", "<html><body>"+test.body+"</body></html>")
+			if got := valueOf(t, responses, "viewport-unit inline styles"); got != test.styles {
+				t.Errorf("viewport-unit inline styles = %q, want %q", got, test.styles)
+			}
+		})
+	}
+}
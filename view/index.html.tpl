@@ -12,6 +12,9 @@
 		const SUCCESS = 0;
 		const FAILURE = 1;
 		const COMPLETE = 2;
+		const PROGRESS = 3;
+		const KEEPALIVE = 4;
+		const WARNING = 5;
 
 		$(function(){
 			sock = new WebSocket(wsuri);
@@ -28,6 +31,10 @@
 					$('#results').append('<li class="list-group-item list-group-item-danger">' + response.Result + '</li>');
 				} else if (response.Status == COMPLETE) {
 					$('#results').append('<li class="list-group-item list-group-item-info">' + response.Result + '</li>');
+				} else if (response.Status == WARNING) {
+					$('#results').append('<li class="list-group-item list-group-item-warning">' + response.Result + '</li>');
+				} else if (response.Status == PROGRESS) {
+					$('#results').append('<li class="list-group-item">' + response.Result + '</li>');
 				}
 			}
 			$('#submitButton').on('click', function(){